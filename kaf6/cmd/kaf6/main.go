@@ -21,6 +21,7 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
@@ -47,20 +48,36 @@ func main() {
 
 	if flag.NArg() < 2 {
 		fmt.Fprintln(os.Stderr, "usage: kaf6 run <scenario.json> [--report-dir reports]")
+		fmt.Fprintln(os.Stderr, "       kaf6 run <scenario.json> --phase produce|verify [--manifest manifest.json] [--verify-timeout 2m]")
 		fmt.Fprintln(os.Stderr, "       kaf6 run-suite <dir> [--suite dir] [--report-dir reports]")
 		fmt.Fprintln(os.Stderr, "       kaf6 select <dir> [--suite dir] [--report-dir reports]")
 		fmt.Fprintln(os.Stderr, "       kaf6 k6-select <dir> [--suite dir]")
 		fmt.Fprintln(os.Stderr, "       kaf6 render-report <report.json> [--report-dir reports]")
+		fmt.Fprintln(os.Stderr, "       kaf6 gc <profile> [--older-than 1h] [--dry-run] [--pattern regexp]")
+		fmt.Fprintln(os.Stderr, "       kaf6 verify <profile> <topic> [--from-offset n] [--to-offset n] [--since t] [--until t] [--not-before t] [--max-skew 5m]")
 		os.Exit(2)
 	}
 	switch flag.Arg(0) {
 	case "run":
 		path := flag.Arg(1)
+		runFlags := flag.NewFlagSet("run", flag.ExitOnError)
+		runFlags.StringVar(&reportDir, "report-dir", reportDir, "report output directory")
+		phase := runFlags.String("phase", "", "run only the produce or verify phase of a two-phase durability run")
+		manifestPath := runFlags.String("manifest", "", "manifest written by the produce phase (verify phase)")
+		verifyTimeout := runFlags.Duration("verify-timeout", 0, "how long the verify phase reads before reporting records as unread (default 2m)")
+		_ = runFlags.Parse(flag.Args()[2:])
 		spec, err := scenario.Load(path)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "load scenario: %v\n", err)
 			os.Exit(1)
 		}
+		spec.Phase = *phase
+		spec.Manifest = *manifestPath
+		spec.VerifyTimeout = *verifyTimeout
+		if spec.Phase == "verify" && spec.Manifest == "" {
+			fmt.Fprintln(os.Stderr, "phase verify needs --manifest")
+			os.Exit(2)
+		}
 		result, err := engine.Run(context.Background(), spec)
 		if result != nil {
 			jsonPath, htmlPath, repErr := report.Write(result, reportDir)
@@ -69,6 +86,14 @@ func main() {
 				os.Exit(1)
 			}
 			fmt.Printf("status: %s\nsummary: %s\nreport: %s\n", result.Status, jsonPath, htmlPath)
+			if result.Manifest != nil {
+				manifestOut := filepath.Join(filepath.Dir(jsonPath), "manifest.json")
+				if err := engine.WriteManifest(manifestOut, result.Manifest); err != nil {
+					fmt.Fprintf(os.Stderr, "write manifest: %v\n", err)
+					os.Exit(1)
+				}
+				fmt.Printf("manifest: %s (%d records)\n", manifestOut, len(result.Manifest.Records))
+			}
 			if os.Getenv("KAF6_OPEN") == "1" {
 				_ = exec.Command("open", htmlPath).Run()
 			}
@@ -206,6 +231,97 @@ func main() {
 		if os.Getenv("KAF6_OPEN") == "1" {
 			_ = exec.Command("open", htmlPath).Run()
 		}
+	case "gc":
+		gcFlags := flag.NewFlagSet("gc", flag.ExitOnError)
+		olderThan := gcFlags.Duration("older-than", time.Hour, "only delete topics and groups from runs older than this")
+		dryRun := gcFlags.Bool("dry-run", false, "list what would be deleted without deleting")
+		pattern := gcFlags.String("pattern", "", "only consider names matching this regular expression instead of the kaf6 and k6 prefixes")
+		_ = gcFlags.Parse(flag.Args()[2:])
+		brokers, err := resolveProfileBrokers(suiteDir, flag.Arg(1))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "load profile: %v\n", err)
+			os.Exit(1)
+		}
+		candidates, err := engine.CollectGarbage(context.Background(), brokers, engine.GCOptions{OlderThan: *olderThan, DryRun: *dryRun, Pattern: *pattern})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "gc: %v\n", err)
+			os.Exit(1)
+		}
+		failed := 0
+		for _, candidate := range candidates {
+			line := fmt.Sprintf("%-5s %-13s %-20s %s", candidate.Kind, candidate.Action, candidate.RunAt.Format(time.RFC3339), candidate.Name)
+			if candidate.Error != "" {
+				line += " (" + candidate.Error + ")"
+			}
+			if candidate.Action == "failed" {
+				failed++
+			}
+			fmt.Println(line)
+		}
+		if failed > 0 {
+			fmt.Fprintf(os.Stderr, "gc: %d deletes failed\n", failed)
+			os.Exit(1)
+		}
+	case "verify":
+		if flag.NArg() < 3 {
+			fmt.Fprintln(os.Stderr, "usage: kaf6 verify <profile> <topic> [--from-offset n] [--to-offset n] [--since t] [--until t] [--not-before t] [--max-skew 5m]")
+			os.Exit(2)
+		}
+		verifyFlags := flag.NewFlagSet("verify", flag.ExitOnError)
+		verifyFlags.StringVar(&reportDir, "report-dir", reportDir, "report output directory")
+		fromOffset := verifyFlags.Int64("from-offset", -1, "first offset to audit in every partition")
+		toOffset := verifyFlags.Int64("to-offset", -1, "last offset to audit in every partition")
+		since := verifyFlags.String("since", "", "audit records at or after this RFC3339 time")
+		until := verifyFlags.String("until", "", "audit records before this RFC3339 time")
+		notBefore := verifyFlags.String("not-before", "", "flag record timestamps before this RFC3339 time")
+		maxSkew := verifyFlags.Duration("max-skew", 5*time.Minute, "allowed clock skew for timestamps in the future")
+		idle := verifyFlags.Duration("idle-timeout", 10*time.Second, "stop reading a partition that returns nothing for this long")
+		_ = verifyFlags.Parse(flag.Args()[3:])
+		opts := engine.AuditOptions{
+			Topic:       flag.Arg(2),
+			FromOffset:  *fromOffset,
+			ToOffset:    *toOffset,
+			MaxSkew:     *maxSkew,
+			IdleTimeout: *idle,
+		}
+		for _, bound := range []struct {
+			name  string
+			value string
+			into  *time.Time
+		}{{"since", *since, &opts.Since}, {"until", *until, &opts.Until}, {"not-before", *notBefore, &opts.NotBefore}} {
+			if bound.value == "" {
+				continue
+			}
+			parsed, err := time.Parse(time.RFC3339, bound.value)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "--%s: %v\n", bound.name, err)
+				os.Exit(2)
+			}
+			*bound.into = parsed
+		}
+		brokers, err := resolveProfileBrokers(suiteDir, flag.Arg(1))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "load profile: %v\n", err)
+			os.Exit(1)
+		}
+		audit, err := engine.Audit(context.Background(), brokers, opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "verify: %v\n", err)
+			os.Exit(1)
+		}
+		jsonPath, htmlPath, err := report.WriteAudit(audit, reportDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "write report: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("status: %s\nrecords: %d gaps: %d duplicates: %d timestamps: %d checksums: %d/%d failed\nsummary: %s\nreport: %s\n",
+			audit.Status, audit.Records, audit.Gaps, audit.Duplicates, audit.TimestampViolations, audit.ChecksumFailures, audit.Checksums, jsonPath, htmlPath)
+		if os.Getenv("KAF6_OPEN") == "1" {
+			_ = exec.Command("open", htmlPath).Run()
+		}
+		if audit.Status != "pass" {
+			os.Exit(1)
+		}
 	case "k6-select":
 		dir := flag.Arg(1)
 		if suiteDir != "" {
@@ -252,10 +368,13 @@ func main() {
 		}
 	default:
 		fmt.Fprintln(os.Stderr, "usage: kaf6 run <scenario.json> [--report-dir reports]")
+		fmt.Fprintln(os.Stderr, "       kaf6 run <scenario.json> --phase produce|verify [--manifest manifest.json] [--verify-timeout 2m]")
 		fmt.Fprintln(os.Stderr, "       kaf6 run-suite <dir> [--suite dir] [--report-dir reports]")
 		fmt.Fprintln(os.Stderr, "       kaf6 select <dir> [--suite dir] [--report-dir reports]")
 		fmt.Fprintln(os.Stderr, "       kaf6 k6-select <dir> [--suite dir]")
 		fmt.Fprintln(os.Stderr, "       kaf6 render-report <report.json> [--report-dir reports]")
+		fmt.Fprintln(os.Stderr, "       kaf6 gc <profile> [--older-than 1h] [--dry-run] [--pattern regexp]")
+		fmt.Fprintln(os.Stderr, "       kaf6 verify <profile> <topic> [--from-offset n] [--to-offset n] [--since t] [--until t] [--not-before t] [--max-skew 5m]")
 		os.Exit(2)
 	}
 }
@@ -400,7 +519,7 @@ func runSuite(dir string, files []string, profileIDs []string, profileFile *prof
 		return jsonPath, htmlPath, repErr
 	}
 	if len(runErrs) > 0 {
-		return jsonPath, htmlPath, fmt.Errorf(strings.Join(runErrs, "; "))
+		return jsonPath, htmlPath, errors.New(strings.Join(runErrs, "; "))
 	}
 	return jsonPath, htmlPath, nil
 }
@@ -592,7 +711,7 @@ func runK6Suite(files []string, profileIDs []string) error {
 		}
 	}
 	if len(errs) > 0 {
-		return fmt.Errorf(strings.Join(errs, "; "))
+		return errors.New(strings.Join(errs, "; "))
 	}
 	return nil
 }
@@ -615,6 +734,27 @@ func resolveK6Binary() string {
 	return "k6"
 }
 
+// resolveProfileBrokers looks the profile up in the suite's profiles.json,
+// falling back to config/profiles.json.
+func resolveProfileBrokers(suiteDir string, profileID string) ([]string, error) {
+	if suiteDir == "" {
+		suiteDir = "suite"
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	file, _, err := profile.LoadWithFallback(filepath.Join(suiteDir, "profiles.json"), filepath.Join(cwd, "config", "profiles.json"))
+	if err != nil {
+		return nil, err
+	}
+	resolved, err := profile.Resolve(file, profileID)
+	if err != nil {
+		return nil, err
+	}
+	return resolved.Brokers, nil
+}
+
 func profileLabel(profileID string) string {
 	if profileID == "" {
 		return "default"
@@ -0,0 +1,407 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+
+	"kaf6/internal/metrics"
+	"kaf6/internal/scenario"
+)
+
+// AdminStepResult is one admin operation. Latency covers the request alone,
+// not the wait for created or deleted topics to settle. Failures lists the
+// expectations that did not hold.
+type AdminStepResult struct {
+	Op       string
+	Topic    string
+	Latency  time.Duration
+	Detail   string
+	Error    string
+	Failures []string
+	Status   string
+}
+
+type adminOutcome struct {
+	detail  string
+	offsets map[int32]int64
+	brokers int
+}
+
+var adminOps = map[string]bool{
+	"create_topics":             true,
+	"create_partitions":         true,
+	"delete_topics":             true,
+	"describe_configs":          true,
+	"alter_configs":             true,
+	"incremental_alter_configs": true,
+	"delete_records":            true,
+	"list_offsets":              true,
+	"describe_cluster":          true,
+}
+
+func runAdmin(ctx context.Context, spec *scenario.ScenarioFile, sum *metrics.Summary, runID string, verbose bool) ([]AdminStepResult, error) {
+	cfg := spec.Scenarios.Admin
+	if err := validateAdminSteps(cfg.Steps); err != nil {
+		return nil, err
+	}
+	client, err := kgo.NewClient(kgo.SeedBrokers(spec.Brokers...))
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	admin := kadm.NewClient(client)
+
+	results := make([]AdminStepResult, 0, len(cfg.Steps))
+	for _, step := range cfg.Steps {
+		topic := replaceRunID(step.Topic, runID)
+		result := AdminStepResult{Op: step.Op, Topic: topic}
+		start := time.Now()
+		outcome, err := runAdminStep(ctx, client, admin, step, topic)
+		result.Latency = time.Since(start)
+		if err == nil {
+			err = settleAdminStep(ctx, admin, step, topic)
+		}
+		result.Detail = outcome.detail
+		result.Error = errorText(err)
+		result.Failures = checkAdminStep(ctx, admin, step.Expect, topic, outcome, err)
+		result.Status = "pass"
+		if len(result.Failures) > 0 {
+			result.Status = "fail"
+			sum.AddAdminFailure()
+		}
+		if verbose {
+			fmt.Printf("admin: %s %s %s (%s) %s\n", step.Op, topic, result.Status, result.Latency.Round(time.Millisecond), strings.Join(result.Failures, "; "))
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// validateAdminSteps rejects steps that cannot run as written before any of
+// them touches the cluster.
+func validateAdminSteps(steps []scenario.AdminStep) error {
+	if len(steps) == 0 {
+		return fmt.Errorf("admin steps are required")
+	}
+	for i, step := range steps {
+		if !adminOps[step.Op] {
+			return fmt.Errorf("admin step %d: unknown op %q", i+1, step.Op)
+		}
+		if step.Op != "describe_cluster" && step.Topic == "" {
+			return fmt.Errorf("admin step %d: %s needs a topic", i+1, step.Op)
+		}
+		// The legacy AlterConfigs replaces the whole set, so there is no
+		// deleting a single key; incremental_alter_configs can.
+		if step.Op == "alter_configs" && len(step.Delete) > 0 {
+			return fmt.Errorf("admin step %d: alter_configs cannot delete configs; use incremental_alter_configs", i+1)
+		}
+	}
+	return nil
+}
+
+func runAdminStep(ctx context.Context, client *kgo.Client, admin *kadm.Client, step scenario.AdminStep, topic string) (adminOutcome, error) {
+	var out adminOutcome
+	switch step.Op {
+	case "create_topics":
+		partitions := step.Partitions
+		if partitions <= 0 {
+			partitions = 1
+		}
+		replication := step.ReplicationFactor
+		if replication == 0 {
+			replication = 1
+		}
+		configs := make(map[string]*string, len(step.Configs))
+		for key, value := range step.Configs {
+			configs[key] = kadm.StringPtr(value)
+		}
+		resp, err := admin.CreateTopics(ctx, partitions, replication, configs, topic)
+		if err != nil {
+			return out, err
+		}
+		created, err := resp.On(topic, nil)
+		if err != nil {
+			return out, err
+		}
+		out.detail = fmt.Sprintf("partitions=%d replication=%d", created.NumPartitions, created.ReplicationFactor)
+		return out, created.Err
+	case "create_partitions":
+		resp, err := admin.UpdatePartitions(ctx, int(step.Partitions), topic)
+		if err != nil {
+			return out, err
+		}
+		updated, err := resp.On(topic, nil)
+		if err != nil {
+			return out, err
+		}
+		out.detail = fmt.Sprintf("partitions=%d", step.Partitions)
+		return out, updated.Err
+	case "delete_topics":
+		resp, err := admin.DeleteTopics(ctx, topic)
+		if err != nil {
+			return out, err
+		}
+		deleted, err := resp.On(topic, nil)
+		if err != nil {
+			return out, err
+		}
+		return out, deleted.Err
+	case "describe_configs":
+		described, err := admin.DescribeTopicConfigs(ctx, topic)
+		if err != nil {
+			return out, err
+		}
+		resource, err := described.On(topic, nil)
+		if err != nil {
+			return out, err
+		}
+		out.detail = fmt.Sprintf("configs=%d", len(resource.Configs))
+		return out, resource.Err
+	case "alter_configs", "incremental_alter_configs":
+		alter := make([]kadm.AlterConfig, 0, len(step.Configs)+len(step.Delete))
+		for _, key := range sortedKeys(step.Configs) {
+			alter = append(alter, kadm.AlterConfig{Op: kadm.SetConfig, Name: key, Value: kadm.StringPtr(step.Configs[key])})
+		}
+		for _, key := range step.Delete {
+			alter = append(alter, kadm.AlterConfig{Op: kadm.DeleteConfig, Name: key})
+		}
+		var resp kadm.AlterConfigsResponses
+		var err error
+		if step.Op == "alter_configs" {
+			// The legacy AlterConfigs replaces the whole set: keys left out
+			// revert to their defaults.
+			resp, err = admin.AlterTopicConfigsState(ctx, alter, topic)
+		} else {
+			resp, err = admin.AlterTopicConfigs(ctx, alter, topic)
+		}
+		if err != nil {
+			return out, err
+		}
+		altered, err := resp.On(topic, nil)
+		if err != nil {
+			return out, err
+		}
+		out.detail = fmt.Sprintf("set=%d deleted=%d", len(step.Configs), len(step.Delete))
+		if step.Op == "alter_configs" {
+			out.detail = fmt.Sprintf("set=%d", len(step.Configs))
+		}
+		return out, altered.Err
+	case "delete_records":
+		before := int64(-1)
+		if step.Offset != "" && step.Offset != "latest" {
+			parsed, err := strconv.ParseInt(step.Offset, 10, 64)
+			if err != nil {
+				return out, fmt.Errorf("delete_records offset must be latest or a number: %s", step.Offset)
+			}
+			before = parsed
+		}
+		ends, err := admin.ListEndOffsets(ctx, topic)
+		if err != nil {
+			return out, err
+		}
+		if err := ends.Error(); err != nil {
+			return out, err
+		}
+		var offsets kadm.Offsets
+		ends.Each(func(end kadm.ListedOffset) {
+			offsets.Add(kadm.Offset{Topic: topic, Partition: end.Partition, At: before})
+		})
+		resp, err := admin.DeleteRecords(ctx, offsets)
+		if err != nil {
+			return out, err
+		}
+		out.offsets = make(map[int32]int64)
+		resp.Each(func(deleted kadm.DeleteRecordsResponse) {
+			if deleted.Err == nil {
+				out.offsets[deleted.Partition] = deleted.LowWatermark
+			}
+		})
+		out.detail = "low watermarks " + formatPartitionOffsets(out.offsets)
+		return out, resp.Error()
+	case "list_offsets":
+		var listed kadm.ListedOffsets
+		var err error
+		switch {
+		case step.Offset == "" || step.Offset == "earliest":
+			listed, err = admin.ListStartOffsets(ctx, topic)
+		case step.Offset == "latest":
+			listed, err = admin.ListEndOffsets(ctx, topic)
+		case strings.HasPrefix(step.Offset, "timestamp:"):
+			at, parseErr := time.Parse(time.RFC3339, strings.TrimPrefix(step.Offset, "timestamp:"))
+			if parseErr != nil {
+				return out, fmt.Errorf("list_offsets timestamp: %w", parseErr)
+			}
+			listed, err = admin.ListOffsetsAfterMilli(ctx, at.UnixMilli(), topic)
+		default:
+			return out, fmt.Errorf("list_offsets offset must be earliest, latest or timestamp:<RFC3339>: %s", step.Offset)
+		}
+		if err != nil {
+			return out, err
+		}
+		out.offsets = make(map[int32]int64)
+		listed.Each(func(offset kadm.ListedOffset) {
+			if offset.Err == nil {
+				out.offsets[offset.Partition] = offset.Offset
+			}
+		})
+		out.detail = formatPartitionOffsets(out.offsets)
+		return out, listed.Error()
+	case "describe_cluster":
+		resp, err := kmsg.NewPtrDescribeClusterRequest().RequestWith(ctx, client)
+		if err != nil {
+			return out, err
+		}
+		out.brokers = len(resp.Brokers)
+		out.detail = fmt.Sprintf("cluster=%s controller=%d brokers=%d", resp.ClusterID, resp.ControllerID, out.brokers)
+		return out, kerr.ErrorForCode(resp.ErrorCode)
+	}
+	return out, fmt.Errorf("unknown admin op %q", step.Op)
+}
+
+// settleAdminStep waits for topic creation and deletion to show up in the
+// metadata, so the next step sees the new state.
+func settleAdminStep(ctx context.Context, admin *kadm.Client, step scenario.AdminStep, topic string) error {
+	switch step.Op {
+	case "create_topics":
+		partitions := step.Partitions
+		if partitions <= 0 {
+			partitions = 1
+		}
+		_, err := waitTopicReady(ctx, admin, topic, partitions)
+		return err
+	case "create_partitions":
+		_, err := waitTopicReady(ctx, admin, topic, step.Partitions)
+		return err
+	case "delete_topics":
+		return waitTopicGone(ctx, admin, topic)
+	}
+	return nil
+}
+
+func checkAdminStep(ctx context.Context, admin *kadm.Client, expect scenario.AdminExpect, topic string, outcome adminOutcome, err error) []string {
+	failures := expectError(expect.Error, err)
+	if expect.Partitions > 0 {
+		topics, listErr := admin.ListTopics(ctx, topic)
+		detail, ok := topics[topic]
+		switch {
+		case listErr != nil:
+			failures = append(failures, fmt.Sprintf("partitions: %v", listErr))
+		case !ok || detail.Err != nil:
+			failures = append(failures, "partitions: topic not in metadata")
+		case int32(len(detail.Partitions)) != expect.Partitions:
+			failures = append(failures, fmt.Sprintf("partitions: expected %d, got %d", expect.Partitions, len(detail.Partitions)))
+		}
+	}
+	if len(expect.Configs) > 0 {
+		checks, describeErr := verifyTopicConfigs(ctx, admin, topic, expect.Configs)
+		if describeErr != nil {
+			failures = append(failures, fmt.Sprintf("configs: %v", describeErr))
+		}
+		for _, check := range checks {
+			if check.Status != "applied" {
+				failures = append(failures, fmt.Sprintf("config %s: expected %s, got %s", check.Key, check.Want, displayValue(check.Got)))
+			}
+		}
+	}
+	failures = append(failures, expectOffsets(expect.Offsets, outcome.offsets)...)
+	if expect.Brokers > 0 && outcome.brokers != expect.Brokers {
+		failures = append(failures, fmt.Sprintf("brokers: expected %d, got %d", expect.Brokers, outcome.brokers))
+	}
+	return failures
+}
+
+// expectError checks err against an expected Kafka error name. An empty want
+// means the step must succeed, "any" that it must fail.
+func expectError(want string, err error) []string {
+	switch code := kafkaErrorCode(err); {
+	case want == "" && err != nil:
+		return []string{fmt.Sprintf("unexpected error: %v", err)}
+	case want == "any" && err == nil:
+		return []string{"expected an error, got none"}
+	case want != "" && want != "any" && code != want:
+		got := code
+		if got == "" {
+			got = errorText(err)
+		}
+		if got == "" {
+			got = "none"
+		}
+		return []string{fmt.Sprintf("expected error %s, got %s", want, got)}
+	}
+	return nil
+}
+
+func expectOffsets(want map[int32]int64, got map[int32]int64) []string {
+	var failures []string
+	partitions := make([]int32, 0, len(want))
+	for partition := range want {
+		partitions = append(partitions, partition)
+	}
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i] < partitions[j] })
+	for _, partition := range partitions {
+		offset, ok := got[partition]
+		if !ok {
+			failures = append(failures, fmt.Sprintf("offset p%d: expected %d, not in response", partition, want[partition]))
+		} else if offset != want[partition] {
+			failures = append(failures, fmt.Sprintf("offset p%d: expected %d, got %d", partition, want[partition], offset))
+		}
+	}
+	return failures
+}
+
+// kafkaErrorCode returns the protocol error name, such as
+// TOPIC_ALREADY_EXISTS, or "" when err is not a Kafka error.
+func kafkaErrorCode(err error) string {
+	var kafkaErr *kerr.Error
+	if errors.As(err, &kafkaErr) {
+		return kafkaErr.Message
+	}
+	return ""
+}
+
+func formatPartitionOffsets(offsets map[int32]int64) string {
+	partitions := make([]int32, 0, len(offsets))
+	for partition := range offsets {
+		partitions = append(partitions, partition)
+	}
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i] < partitions[j] })
+	parts := make([]string, 0, len(partitions))
+	for _, partition := range partitions {
+		parts = append(parts, fmt.Sprintf("p%d=%d", partition, offsets[partition]))
+	}
+	return strings.Join(parts, " ")
+}
+
+func displayValue(value string) string {
+	if value == "" {
+		return "(unset)"
+	}
+	return value
+}
@@ -0,0 +1,142 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/twmb/franz-go/pkg/kerr"
+
+	"kaf6/internal/scenario"
+)
+
+func TestValidateAdminSteps(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []scenario.AdminStep
+		want  string
+	}{
+		{"empty", nil, "admin steps are required"},
+		{"unknown op", []scenario.AdminStep{{Op: "drop_topics", Topic: "t"}}, `admin step 1: unknown op "drop_topics"`},
+		{"missing topic", []scenario.AdminStep{{Op: "describe_cluster"}, {Op: "create_topics"}}, "admin step 2: create_topics needs a topic"},
+		{"alter delete", []scenario.AdminStep{{Op: "alter_configs", Topic: "t", Delete: []string{"retention.ms"}}}, "admin step 1: alter_configs cannot delete configs"},
+		{"incremental delete", []scenario.AdminStep{{Op: "incremental_alter_configs", Topic: "t", Delete: []string{"retention.ms"}}}, ""},
+		{"describe cluster", []scenario.AdminStep{{Op: "describe_cluster"}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateAdminSteps(tt.steps)
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("validateAdminSteps: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+				t.Fatalf("error = %v, want prefix %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpectError(t *testing.T) {
+	exists := fmt.Errorf("create t: %w", kerr.TopicAlreadyExists)
+	tests := []struct {
+		name string
+		want string
+		err  error
+		fail string
+	}{
+		{"success", "", nil, ""},
+		{"unexpected", "", exists, "unexpected error: " + exists.Error()},
+		{"any matches", "any", exists, ""},
+		{"any without error", "any", nil, "expected an error, got none"},
+		{"code matches", "TOPIC_ALREADY_EXISTS", exists, ""},
+		{"code differs", "UNKNOWN_TOPIC_OR_PARTITION", exists, "expected error UNKNOWN_TOPIC_OR_PARTITION, got TOPIC_ALREADY_EXISTS"},
+		{"code without error", "TOPIC_ALREADY_EXISTS", nil, "expected error TOPIC_ALREADY_EXISTS, got none"},
+		{"non-kafka error", "TOPIC_ALREADY_EXISTS", errors.New("dial tcp: refused"), "expected error TOPIC_ALREADY_EXISTS, got dial tcp: refused"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var want []string
+			if tt.fail != "" {
+				want = []string{tt.fail}
+			}
+			if got := expectError(tt.want, tt.err); !reflect.DeepEqual(got, want) {
+				t.Fatalf("expectError = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestExpectOffsets(t *testing.T) {
+	got := map[int32]int64{0: 10, 1: 7}
+	tests := []struct {
+		name string
+		want map[int32]int64
+		fail []string
+	}{
+		{"none expected", nil, nil},
+		{"match", map[int32]int64{0: 10, 1: 7}, nil},
+		{"subset", map[int32]int64{1: 7}, nil},
+		{"mismatch and missing", map[int32]int64{2: 0, 0: 11}, []string{
+			"offset p0: expected 11, got 10",
+			"offset p2: expected 0, not in response",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if failures := expectOffsets(tt.want, got); !reflect.DeepEqual(failures, tt.fail) {
+				t.Fatalf("expectOffsets = %q, want %q", failures, tt.fail)
+			}
+		})
+	}
+}
+
+func TestCheckAdminStep(t *testing.T) {
+	outcome := adminOutcome{offsets: map[int32]int64{0: 5}, brokers: 3}
+	tests := []struct {
+		name   string
+		expect scenario.AdminExpect
+		err    error
+		fail   []string
+	}{
+		{"pass", scenario.AdminExpect{Offsets: map[int32]int64{0: 5}, Brokers: 3}, nil, nil},
+		{"expected error", scenario.AdminExpect{Error: "INVALID_PARTITIONS"}, kerr.InvalidPartitions, nil},
+		{"every failure", scenario.AdminExpect{Offsets: map[int32]int64{0: 6}, Brokers: 1}, kerr.InvalidPartitions, []string{
+			"unexpected error: " + kerr.InvalidPartitions.Error(),
+			"offset p0: expected 6, got 5",
+			"brokers: expected 1, got 3",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Without partition or config expectations the admin client is
+			// never used.
+			failures := checkAdminStep(context.Background(), nil, tt.expect, "t", outcome, tt.err)
+			if !reflect.DeepEqual(failures, tt.fail) {
+				t.Fatalf("checkAdminStep = %q, want %q", failures, tt.fail)
+			}
+		})
+	}
+}
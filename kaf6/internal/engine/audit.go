@@ -0,0 +1,418 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+const maxAuditProblems = 200
+
+// auditPollTimeout bounds each poll, so partitions are checked for idleness
+// even while no records arrive at all.
+const auditPollTimeout = time.Second
+
+// AuditOptions selects the range to audit. Offsets below zero and zero times
+// mean unbounded; FromOffset/ToOffset (inclusive) and Since/Until apply to
+// every partition.
+type AuditOptions struct {
+	Topic       string
+	FromOffset  int64
+	ToOffset    int64
+	Since       time.Time
+	Until       time.Time
+	NotBefore   time.Time
+	MaxSkew     time.Duration
+	IdleTimeout time.Duration
+}
+
+// AuditResult is a read-only audit of a topic's structural invariants.
+// Explained gaps are offset gaps on a compacted topic.
+type AuditResult struct {
+	ID                  string
+	Topic               string
+	Brokers             []string
+	StartedAt           time.Time
+	Duration            time.Duration
+	Range               string
+	CleanupPolicy       string
+	TimestampType       string
+	Partitions          []PartitionAudit
+	Records             int64
+	ControlRecords      int64
+	Gaps                int64
+	ExplainedGaps       int64
+	Duplicates          int64
+	TimestampViolations int64
+	Checksums           int64
+	ChecksumFailures    int64
+	Unread              int64
+	Problems            []AuditProblem
+	Status              string
+}
+
+// PartitionAudit covers one partition: Start and End bound the audited
+// offsets (End exclusive), First and Last are the offsets actually read.
+type PartitionAudit struct {
+	Partition int32
+	Start     int64
+	End       int64
+	First     int64
+	Last      int64
+	Records   int64
+	Gaps      int64
+}
+
+type AuditProblem struct {
+	Partition int32
+	Offset    int64
+	Kind      string
+	Detail    string
+}
+
+func Audit(ctx context.Context, brokers []string, opts AuditOptions) (*AuditResult, error) {
+	started := time.Now()
+	out := &AuditResult{
+		ID:        "audit-" + started.Format("20060102-150405"),
+		Topic:     opts.Topic,
+		Brokers:   brokers,
+		StartedAt: started,
+		Range:     auditRange(opts),
+	}
+	if opts.IdleTimeout <= 0 {
+		opts.IdleTimeout = 10 * time.Second
+	}
+	client, err := kgo.NewClient(kgo.SeedBrokers(brokers...))
+	if err != nil {
+		return nil, err
+	}
+	admin := kadm.NewClient(client)
+	configs, err := admin.DescribeTopicConfigs(ctx, opts.Topic)
+	if err == nil {
+		if resource, onErr := configs.On(opts.Topic, nil); onErr == nil && resource.Err == nil {
+			for _, config := range resource.Configs {
+				switch config.Key {
+				case "cleanup.policy":
+					out.CleanupPolicy = config.MaybeValue()
+				case "message.timestamp.type":
+					out.TimestampType = config.MaybeValue()
+				}
+			}
+		}
+	}
+	bounds, err := auditBounds(ctx, admin, opts)
+	client.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	state := newAuditState(out, opts, bounds)
+	if len(state.remaining) > 0 {
+		assign := make(map[int32]kgo.Offset, len(state.remaining))
+		for partition := range state.remaining {
+			assign[partition] = kgo.NewOffset().At(state.partitions[partition].Start)
+		}
+		consumer, err := kgo.NewClient(
+			kgo.SeedBrokers(brokers...),
+			kgo.ConsumePartitions(map[string]map[int32]kgo.Offset{opts.Topic: assign}),
+			kgo.KeepControlRecords(),
+		)
+		if err != nil {
+			return nil, err
+		}
+		defer consumer.Close()
+		// Each partition gets its own idle clock: one that stops returning
+		// records is paused and left unread, while the others keep going.
+		progress := make(map[int32]time.Time, len(assign))
+		for partition := range assign {
+			progress[partition] = time.Now()
+		}
+		for len(progress) > 0 {
+			pollCtx, cancelPoll := context.WithTimeout(ctx, min(opts.IdleTimeout, auditPollTimeout))
+			fetches := consumer.PollFetches(pollCtx)
+			cancelPoll()
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if errs := fetches.Errors(); len(errs) > 0 && pollCtx.Err() == nil {
+				return nil, fmt.Errorf("fetch errors: %+v", errs)
+			}
+			now := time.Now()
+			fetches.EachRecord(func(record *kgo.Record) {
+				if _, active := progress[record.Partition]; active {
+					progress[record.Partition] = now
+				}
+				state.observe(record)
+				if _, left := state.remaining[record.Partition]; !left {
+					delete(progress, record.Partition)
+				}
+			})
+			if idle := idlePartitions(progress, now, opts.IdleTimeout); len(idle) > 0 {
+				consumer.PauseFetchPartitions(map[string][]int32{opts.Topic: idle})
+			}
+		}
+	}
+	state.finish()
+	out.Duration = time.Since(started)
+	return out, nil
+}
+
+// idlePartitions removes and returns the partitions that have not returned a
+// record for timeout, in partition order.
+func idlePartitions(progress map[int32]time.Time, now time.Time, timeout time.Duration) []int32 {
+	var idle []int32
+	for partition, last := range progress {
+		if now.Sub(last) >= timeout {
+			idle = append(idle, partition)
+			delete(progress, partition)
+		}
+	}
+	sort.Slice(idle, func(i, j int) bool { return idle[i] < idle[j] })
+	return idle
+}
+
+// auditState classifies the records of one audit as they are read. remaining
+// holds the exclusive end offset of every partition not yet read to its end.
+type auditState struct {
+	out           *AuditResult
+	opts          AuditOptions
+	compacted     bool
+	logAppend     bool
+	latest        time.Time
+	partitions    map[int32]*PartitionAudit
+	remaining     map[int32]int64
+	seen          map[string]AuditProblem
+	lastTimestamp map[int32]time.Time
+}
+
+func newAuditState(out *AuditResult, opts AuditOptions, bounds []PartitionAudit) *auditState {
+	s := &auditState{
+		out:           out,
+		opts:          opts,
+		compacted:     strings.Contains(out.CleanupPolicy, "compact"),
+		logAppend:     out.TimestampType == "LogAppendTime",
+		latest:        time.Now().Add(opts.MaxSkew),
+		partitions:    make(map[int32]*PartitionAudit),
+		remaining:     make(map[int32]int64),
+		seen:          make(map[string]AuditProblem),
+		lastTimestamp: make(map[int32]time.Time),
+	}
+	for _, bound := range bounds {
+		audit := bound
+		audit.First, audit.Last = -1, -1
+		s.partitions[bound.Partition] = &audit
+		if bound.End > bound.Start {
+			s.remaining[bound.Partition] = bound.End
+		}
+	}
+	return s
+}
+
+func (s *auditState) problem(partition int32, offset int64, kind string, detail string) {
+	if len(s.out.Problems) < maxAuditProblems {
+		s.out.Problems = append(s.out.Problems, AuditProblem{Partition: partition, Offset: offset, Kind: kind, Detail: detail})
+	}
+}
+
+func (s *auditState) observe(record *kgo.Record) {
+	end, ok := s.remaining[record.Partition]
+	if !ok || record.Offset >= end {
+		return
+	}
+	out := s.out
+	audit := s.partitions[record.Partition]
+	expected := audit.Start
+	if audit.Last >= 0 {
+		expected = audit.Last + 1
+	}
+	switch {
+	case record.Offset < expected:
+		s.problem(record.Partition, record.Offset, "offset_regression", fmt.Sprintf("expected %d", expected))
+	case record.Offset > expected:
+		audit.Gaps++
+		if s.compacted {
+			out.ExplainedGaps++
+		} else {
+			out.Gaps++
+			s.problem(record.Partition, expected, "gap", fmt.Sprintf("%d offsets missing before %d", record.Offset-expected, record.Offset))
+		}
+	}
+	if audit.First < 0 {
+		audit.First = record.Offset
+	}
+	audit.Last = max(audit.Last, record.Offset)
+	if record.Offset+1 >= end {
+		delete(s.remaining, record.Partition)
+	}
+	if record.Attrs.IsControl() {
+		out.ControlRecords++
+		return
+	}
+	audit.Records++
+	out.Records++
+
+	if id := recordID(record); id != "" {
+		if first, dup := s.seen[id]; dup {
+			out.Duplicates++
+			s.problem(record.Partition, record.Offset, "duplicate_id", fmt.Sprintf("%s first seen at partition %d offset %d", id, first.Partition, first.Offset))
+		} else {
+			s.seen[id] = AuditProblem{Partition: record.Partition, Offset: record.Offset}
+		}
+	}
+
+	last := s.lastTimestamp[record.Partition]
+	switch {
+	case record.Timestamp.UnixMilli() < 0:
+		out.TimestampViolations++
+		s.problem(record.Partition, record.Offset, "timestamp", "negative timestamp")
+	case !s.opts.NotBefore.IsZero() && record.Timestamp.Before(s.opts.NotBefore):
+		out.TimestampViolations++
+		s.problem(record.Partition, record.Offset, "timestamp", fmt.Sprintf("%s is before %s", record.Timestamp.Format(time.RFC3339Nano), s.opts.NotBefore.Format(time.RFC3339)))
+	case record.Timestamp.After(s.latest):
+		out.TimestampViolations++
+		s.problem(record.Partition, record.Offset, "timestamp", fmt.Sprintf("%s is in the future", record.Timestamp.Format(time.RFC3339Nano)))
+	case s.logAppend && record.Timestamp.Before(last):
+		out.TimestampViolations++
+		s.problem(record.Partition, record.Offset, "timestamp", fmt.Sprintf("LogAppendTime went back from %s", last.Format(time.RFC3339Nano)))
+	}
+	if record.Timestamp.After(last) {
+		s.lastTimestamp[record.Partition] = record.Timestamp
+	}
+
+	if embedded, actual, ok := verifyChecksum(record, ""); ok {
+		out.Checksums++
+		if embedded != actual {
+			out.ChecksumFailures++
+			s.problem(record.Partition, record.Offset, "checksum", fmt.Sprintf("embedded %s, computed %s", embedded, actual))
+		}
+	}
+}
+
+// finish reports the partitions left unread and sets the status.
+func (s *auditState) finish() {
+	out := s.out
+	for partition, end := range s.remaining {
+		audit := s.partitions[partition]
+		next := audit.Start
+		if audit.Last >= 0 {
+			next = audit.Last + 1
+		}
+		if s.compacted {
+			out.ExplainedGaps++
+			continue
+		}
+		out.Unread += end - next
+		s.problem(partition, next, "unread", fmt.Sprintf("no records after %d before the end offset %d", next-1, end))
+	}
+	for _, audit := range s.partitions {
+		out.Partitions = append(out.Partitions, *audit)
+	}
+	sort.Slice(out.Partitions, func(i, j int) bool { return out.Partitions[i].Partition < out.Partitions[j].Partition })
+	sort.SliceStable(out.Problems, func(i, j int) bool {
+		if out.Problems[i].Partition != out.Problems[j].Partition {
+			return out.Problems[i].Partition < out.Problems[j].Partition
+		}
+		return out.Problems[i].Offset < out.Problems[j].Offset
+	})
+	out.Status = "pass"
+	if out.Gaps > 0 || out.Duplicates > 0 || out.TimestampViolations > 0 || out.ChecksumFailures > 0 || out.Unread > 0 || len(out.Problems) > 0 {
+		out.Status = "fail"
+	}
+}
+
+// auditBounds resolves the audited offset range of every partition, clamped
+// to what the log currently holds.
+func auditBounds(ctx context.Context, admin *kadm.Client, opts AuditOptions) ([]PartitionAudit, error) {
+	starts, err := admin.ListStartOffsets(ctx, opts.Topic)
+	if err == nil {
+		err = starts.Error()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("list start offsets: %w", err)
+	}
+	ends, err := admin.ListEndOffsets(ctx, opts.Topic)
+	if err == nil {
+		err = ends.Error()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("list end offsets: %w", err)
+	}
+	var since, until kadm.ListedOffsets
+	if !opts.Since.IsZero() {
+		if since, err = admin.ListOffsetsAfterMilli(ctx, opts.Since.UnixMilli(), opts.Topic); err != nil {
+			return nil, fmt.Errorf("list offsets since: %w", err)
+		}
+	}
+	if !opts.Until.IsZero() {
+		if until, err = admin.ListOffsetsAfterMilli(ctx, opts.Until.UnixMilli(), opts.Topic); err != nil {
+			return nil, fmt.Errorf("list offsets until: %w", err)
+		}
+	}
+	var bounds []PartitionAudit
+	starts.Each(func(start kadm.ListedOffset) {
+		bound := PartitionAudit{Partition: start.Partition, Start: start.Offset}
+		if end, ok := ends.Lookup(opts.Topic, start.Partition); ok {
+			bound.End = end.Offset
+		}
+		if opts.FromOffset >= 0 {
+			bound.Start = max(bound.Start, opts.FromOffset)
+		}
+		if opts.ToOffset >= 0 {
+			bound.End = min(bound.End, opts.ToOffset+1)
+		}
+		if listed, ok := since.Lookup(opts.Topic, start.Partition); ok && listed.Err == nil {
+			bound.Start = max(bound.Start, listed.Offset)
+		}
+		if listed, ok := until.Lookup(opts.Topic, start.Partition); ok && listed.Err == nil {
+			bound.End = min(bound.End, listed.Offset)
+		}
+		bound.End = max(bound.End, bound.Start)
+		bounds = append(bounds, bound)
+	})
+	if len(bounds) == 0 {
+		return nil, fmt.Errorf("topic %s not found", opts.Topic)
+	}
+	return bounds, nil
+}
+
+func auditRange(opts AuditOptions) string {
+	var parts []string
+	if opts.FromOffset >= 0 {
+		parts = append(parts, fmt.Sprintf("from offset %d", opts.FromOffset))
+	}
+	if opts.ToOffset >= 0 {
+		parts = append(parts, fmt.Sprintf("to offset %d", opts.ToOffset))
+	}
+	if !opts.Since.IsZero() {
+		parts = append(parts, "since "+opts.Since.Format(time.RFC3339))
+	}
+	if !opts.Until.IsZero() {
+		parts = append(parts, "until "+opts.Until.Format(time.RFC3339))
+	}
+	if len(parts) == 0 {
+		return "entire topic"
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,162 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package engine
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func auditRecord(partition int32, offset int64, id string, at time.Time) *kgo.Record {
+	record := &kgo.Record{Partition: partition, Offset: offset, Timestamp: at}
+	if id != "" {
+		record.Headers = []kgo.RecordHeader{{Key: recordIDHeader, Value: []byte(id)}}
+	}
+	return record
+}
+
+func TestAuditStateClassifies(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name          string
+		policy        string
+		timestampType string
+		opts          AuditOptions
+		records       []*kgo.Record
+		want          AuditResult
+		kinds         []string
+	}{
+		{
+			name:    "clean",
+			records: []*kgo.Record{auditRecord(0, 0, "a", now), auditRecord(0, 1, "b", now), auditRecord(0, 2, "c", now)},
+			want:    AuditResult{Records: 3, Status: "pass"},
+		},
+		{
+			name:    "gap",
+			records: []*kgo.Record{auditRecord(0, 0, "a", now), auditRecord(0, 2, "c", now)},
+			want:    AuditResult{Records: 2, Gaps: 1, Status: "fail"},
+			kinds:   []string{"gap"},
+		},
+		{
+			name:    "compacted gap",
+			policy:  "compact",
+			records: []*kgo.Record{auditRecord(0, 0, "a", now), auditRecord(0, 2, "c", now)},
+			want:    AuditResult{Records: 2, ExplainedGaps: 1, Status: "pass"},
+		},
+		{
+			name:    "duplicate id",
+			records: []*kgo.Record{auditRecord(0, 0, "a", now), auditRecord(0, 1, "a", now), auditRecord(0, 2, "c", now)},
+			want:    AuditResult{Records: 3, Duplicates: 1, Status: "fail"},
+			kinds:   []string{"duplicate_id"},
+		},
+		{
+			name:    "future timestamp beyond skew",
+			opts:    AuditOptions{MaxSkew: time.Minute},
+			records: []*kgo.Record{auditRecord(0, 0, "a", now), auditRecord(0, 1, "b", now.Add(30*time.Second)), auditRecord(0, 2, "c", now.Add(time.Hour))},
+			want:    AuditResult{Records: 3, TimestampViolations: 1, Status: "fail"},
+			kinds:   []string{"timestamp"},
+		},
+		{
+			name:    "before not-before",
+			opts:    AuditOptions{NotBefore: now.Add(-time.Minute)},
+			records: []*kgo.Record{auditRecord(0, 0, "a", now.Add(-time.Hour)), auditRecord(0, 1, "b", now), auditRecord(0, 2, "c", now)},
+			want:    AuditResult{Records: 3, TimestampViolations: 1, Status: "fail"},
+			kinds:   []string{"timestamp"},
+		},
+		{
+			name:          "log append time going back",
+			timestampType: "LogAppendTime",
+			records:       []*kgo.Record{auditRecord(0, 0, "a", now), auditRecord(0, 1, "b", now.Add(-time.Second)), auditRecord(0, 2, "c", now)},
+			want:          AuditResult{Records: 3, TimestampViolations: 1, Status: "fail"},
+			kinds:         []string{"timestamp"},
+		},
+		{
+			name:    "unread tail",
+			records: []*kgo.Record{auditRecord(0, 0, "a", now)},
+			want:    AuditResult{Records: 1, Unread: 2, Status: "fail"},
+			kinds:   []string{"unread"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &AuditResult{CleanupPolicy: tt.policy, TimestampType: tt.timestampType}
+			state := newAuditState(out, tt.opts, []PartitionAudit{{Partition: 0, Start: 0, End: 3}})
+			for _, record := range tt.records {
+				state.observe(record)
+			}
+			state.finish()
+			got := AuditResult{
+				Records:             out.Records,
+				Gaps:                out.Gaps,
+				ExplainedGaps:       out.ExplainedGaps,
+				Duplicates:          out.Duplicates,
+				TimestampViolations: out.TimestampViolations,
+				Unread:              out.Unread,
+				Status:              out.Status,
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("audit = %+v, want %+v", got, tt.want)
+			}
+			var kinds []string
+			for _, problem := range out.Problems {
+				kinds = append(kinds, problem.Kind)
+			}
+			if !reflect.DeepEqual(kinds, tt.kinds) {
+				t.Fatalf("problems = %v, want %v", kinds, tt.kinds)
+			}
+		})
+	}
+}
+
+func TestAuditStateIgnoresOutOfRange(t *testing.T) {
+	now := time.Now()
+	out := &AuditResult{}
+	state := newAuditState(out, AuditOptions{}, []PartitionAudit{{Partition: 0, Start: 5, End: 7}, {Partition: 1, Start: 3, End: 3}})
+	for _, record := range []*kgo.Record{auditRecord(0, 5, "a", now), auditRecord(0, 6, "b", now), auditRecord(0, 7, "c", now), auditRecord(1, 3, "d", now)} {
+		state.observe(record)
+	}
+	state.finish()
+	if out.Records != 2 || out.Status != "pass" {
+		t.Fatalf("records = %d status = %s, want 2 pass", out.Records, out.Status)
+	}
+	want := []PartitionAudit{
+		{Partition: 0, Start: 5, End: 7, First: 5, Last: 6, Records: 2},
+		{Partition: 1, Start: 3, End: 3, First: -1, Last: -1},
+	}
+	if !reflect.DeepEqual(out.Partitions, want) {
+		t.Fatalf("partitions = %+v, want %+v", out.Partitions, want)
+	}
+}
+
+func TestIdlePartitions(t *testing.T) {
+	now := time.Now()
+	progress := map[int32]time.Time{
+		0: now.Add(-11 * time.Second),
+		1: now.Add(-time.Second),
+		2: now.Add(-10 * time.Second),
+	}
+	if idle := idlePartitions(progress, now, 10*time.Second); !reflect.DeepEqual(idle, []int32{0, 2}) {
+		t.Fatalf("idle = %v, want [0 2]", idle)
+	}
+	if _, ok := progress[1]; !ok || len(progress) != 1 {
+		t.Fatalf("progress = %v, want only partition 1 left", progress)
+	}
+}
@@ -0,0 +1,144 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package engine
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// checksumHeader carries a hash of the record's key, value and other headers.
+const checksumHeader = "kaf6-checksum"
+
+// checksumField is the JSON field form: the producer puts it first in the
+// value object, and the hash covers the value without it.
+const checksumField = `{"kaf6_checksum":"`
+
+// checksumLength is the hex length of recordChecksum.
+const checksumLength = 16
+
+// maxCorruptRecords caps the corrupt records listed in the result; the
+// corrupt_records metric counts all of them.
+const maxCorruptRecords = 100
+
+// CorruptRecord is a consumed record whose embedded checksum does not match
+// its content.
+type CorruptRecord struct {
+	Partition int32
+	Offset    int64
+	Expected  string
+	Actual    string
+}
+
+// recordChecksum hashes the key, the value and every header except the
+// checksum itself and the send time, which is stamped after the checksum.
+// Each field is length-prefixed so that moving bytes between fields changes
+// the result.
+func recordChecksum(key []byte, value []byte, headers []kgo.RecordHeader) string {
+	h := sha256.New()
+	write := func(b []byte) {
+		var size [4]byte
+		binary.BigEndian.PutUint32(size[:], uint32(len(b)))
+		h.Write(size[:])
+		h.Write(b)
+	}
+	write(key)
+	write(value)
+	for _, header := range headers {
+		if header.Key == checksumHeader || header.Key == sentAtHeader {
+			continue
+		}
+		write([]byte(header.Key))
+		write(header.Value)
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// embedChecksum adds the checksum to a record that is otherwise ready to
+// send, as a header or as the first field of a JSON object value.
+func embedChecksum(record *kgo.Record, mode string) error {
+	switch mode {
+	case "", "none":
+		return nil
+	case "header":
+		sum := recordChecksum(record.Key, record.Value, record.Headers)
+		record.Headers = append(record.Headers, kgo.RecordHeader{Key: checksumHeader, Value: []byte(sum)})
+		return nil
+	case "field":
+		value := bytes.TrimSpace(record.Value)
+		if len(value) < 2 || value[0] != '{' || !json.Valid(value) {
+			return fmt.Errorf("checksum field needs a JSON object value")
+		}
+		// Hash the value the way verifyChecksum rebuilds it, without the
+		// whitespace after the opening brace.
+		rest := bytes.TrimSpace(value[1:])
+		sum := recordChecksum(record.Key, append([]byte("{"), rest...), record.Headers)
+		embedded := append([]byte(checksumField), sum...)
+		if rest[0] == '}' {
+			embedded = append(embedded, `"}`...)
+		} else {
+			embedded = append(embedded, `",`...)
+			embedded = append(embedded, rest...)
+		}
+		record.Value = embedded
+		return nil
+	}
+	return fmt.Errorf("unknown checksum mode: %s", mode)
+}
+
+// verifyChecksum reports whether the record carries a checksum and, if so,
+// the embedded and recomputed values. With expect set to "header" or "field"
+// the record has to carry its checksum in that form: a record without one is
+// reported with the actual value "missing", so that a dropped header or a
+// damaged start of the value counts as corruption instead of being skipped.
+func verifyChecksum(record *kgo.Record, expect string) (embedded string, actual string, present bool) {
+	if expect != "field" {
+		for _, header := range record.Headers {
+			if header.Key == checksumHeader {
+				return string(header.Value), recordChecksum(record.Key, record.Value, record.Headers), true
+			}
+		}
+		if expect == "header" {
+			return "", "missing", true
+		}
+	}
+	if !bytes.HasPrefix(record.Value, []byte(checksumField)) || len(record.Value) < len(checksumField)+checksumLength+2 {
+		if expect == "field" {
+			return "", "missing", true
+		}
+		return "", "", false
+	}
+	end := len(checksumField) + checksumLength
+	embedded = string(record.Value[len(checksumField):end])
+	var original []byte
+	switch string(record.Value[end : end+2]) {
+	case `"}`:
+		original = []byte("{}")
+	case `",`:
+		original = append([]byte("{"), record.Value[end+2:]...)
+	default:
+		return embedded, "malformed", true
+	}
+	return embedded, recordChecksum(record.Key, original, record.Headers), true
+}
@@ -0,0 +1,133 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package engine
+
+import (
+	"testing"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func checksummed(t *testing.T, mode string) *kgo.Record {
+	t.Helper()
+	record := &kgo.Record{
+		Key:     []byte("key"),
+		Value:   []byte(`{ "a": 1 }`),
+		Headers: []kgo.RecordHeader{{Key: "run", Value: []byte("r1")}},
+	}
+	if err := embedChecksum(record, mode); err != nil {
+		t.Fatal(err)
+	}
+	return record
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	tests := []struct {
+		name    string
+		record  func(t *testing.T) *kgo.Record
+		expect  string
+		present bool
+		valid   bool
+		actual  string
+	}{
+		{
+			name:    "header intact",
+			record:  func(t *testing.T) *kgo.Record { return checksummed(t, "header") },
+			expect:  "header",
+			present: true,
+			valid:   true,
+		},
+		{
+			name:    "field intact",
+			record:  func(t *testing.T) *kgo.Record { return checksummed(t, "field") },
+			expect:  "field",
+			present: true,
+			valid:   true,
+		},
+		{
+			name: "header value changed",
+			record: func(t *testing.T) *kgo.Record {
+				record := checksummed(t, "header")
+				record.Value[3] = 'b'
+				return record
+			},
+			expect:  "header",
+			present: true,
+		},
+		{
+			name: "send time is not covered",
+			record: func(t *testing.T) *kgo.Record {
+				record := checksummed(t, "header")
+				record.Headers = append(record.Headers, kgo.RecordHeader{Key: sentAtHeader, Value: []byte("1")})
+				return record
+			},
+			expect:  "header",
+			present: true,
+			valid:   true,
+		},
+		{
+			name: "header dropped",
+			record: func(t *testing.T) *kgo.Record {
+				record := checksummed(t, "header")
+				record.Headers = record.Headers[:len(record.Headers)-1]
+				return record
+			},
+			expect:  "header",
+			present: true,
+			actual:  "missing",
+		},
+		{
+			name: "field prefix damaged",
+			record: func(t *testing.T) *kgo.Record {
+				record := checksummed(t, "field")
+				record.Value[0] = '['
+				return record
+			},
+			expect:  "field",
+			present: true,
+			actual:  "missing",
+		},
+		{
+			name:   "no checksum expected",
+			record: func(t *testing.T) *kgo.Record { return checksummed(t, "none") },
+		},
+		{
+			name:    "detected without expectation",
+			record:  func(t *testing.T) *kgo.Record { return checksummed(t, "field") },
+			present: true,
+			valid:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			embedded, actual, present := verifyChecksum(tt.record(t), tt.expect)
+			if present != tt.present {
+				t.Fatalf("present = %t, want %t", present, tt.present)
+			}
+			if !present {
+				return
+			}
+			if valid := embedded == actual; valid != tt.valid {
+				t.Fatalf("embedded %q, actual %q: valid = %t, want %t", embedded, actual, valid, tt.valid)
+			}
+			if tt.actual != "" && actual != tt.actual {
+				t.Fatalf("actual = %q, want %q", actual, tt.actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"kaf6/internal/scenario"
+)
+
+const cleanupTimeout = time.Minute
+
+// CleanupResult records the teardown of run-scoped topics and groups. Skipped
+// is set when the mode kept them, Failures lists what could not be deleted.
+type CleanupResult struct {
+	Mode     string
+	Skipped  bool
+	Topics   []string
+	Groups   []string
+	Failures []string
+}
+
+// cleanupMode defaults to on_success, except that two-phase runs keep their
+// data unless the scenario asks for cleanup: the produce phase always does,
+// since the verify phase still has to read the topic.
+func cleanupMode(spec *scenario.ScenarioFile) string {
+	switch {
+	case spec.Phase == "produce":
+		return "never"
+	case spec.Cleanup != "":
+		return spec.Cleanup
+	case spec.Phase == "verify":
+		return "never"
+	}
+	return "on_success"
+}
+
+// teardown deletes the given topics and consumer groups, usually from
+// runTopics and runGroups. It uses its own timeout so that an expired run
+// context still cleans up.
+func teardown(ctx context.Context, spec *scenario.ScenarioFile, names []string, groups []string, status string, verbose bool) *CleanupResult {
+	out := &CleanupResult{Mode: cleanupMode(spec)}
+	if out.Mode == "never" || (out.Mode == "on_success" && status != "pass") {
+		out.Skipped = true
+		return out
+	}
+	if len(names) == 0 && len(groups) == 0 {
+		return out
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+	defer cancel()
+	client, err := kgo.NewClient(kgo.SeedBrokers(spec.Brokers...))
+	if err != nil {
+		out.Failures = append(out.Failures, err.Error())
+		return out
+	}
+	defer client.Close()
+	admin := kadm.NewClient(client)
+
+	if len(groups) > 0 {
+		resp, err := admin.DeleteGroups(ctx, groups...)
+		for _, group := range groups {
+			switch deleted, ok := resp[group]; {
+			case err != nil:
+				out.Failures = append(out.Failures, fmt.Sprintf("group %s: %v", group, err))
+			case !ok:
+				out.Failures = append(out.Failures, fmt.Sprintf("group %s: no response", group))
+			case deleted.Err == nil:
+				out.Groups = append(out.Groups, group)
+			case errors.Is(deleted.Err, kerr.GroupIDNotFound):
+			default:
+				out.Failures = append(out.Failures, fmt.Sprintf("group %s: %v", group, deleted.Err))
+			}
+		}
+	}
+	for _, name := range names {
+		if err := deleteTopic(ctx, admin, name); err != nil {
+			out.Failures = append(out.Failures, err.Error())
+			continue
+		}
+		out.Topics = append(out.Topics, name)
+	}
+	if verbose {
+		fmt.Printf("cleanup: topics=%v groups=%v failures=%d\n", out.Topics, out.Groups, len(out.Failures))
+	}
+	return out
+}
+
+// runTopics lists the topics created during setup plus any undeclared
+// {{run_id}} topic a step produced to (auto-created by the broker) or an admin
+// step created.
+func runTopics(spec *scenario.ScenarioFile, runID string, topics []TopicResult) []string {
+	var names []string
+	seen := map[string]bool{}
+	add := func(name string) {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	declared := map[string]bool{}
+	for _, topic := range spec.Topics {
+		declared[resolveTopic(topic.Name, nil, runID)] = true
+	}
+	for _, topic := range topics {
+		if !topic.Existed {
+			add(topic.Name)
+		}
+	}
+	var templates []string
+	if spec.Scenarios.Producer != nil {
+		templates = append(templates, spec.Scenarios.Producer.Topic)
+	}
+	if spec.Scenarios.Consumer != nil {
+		templates = append(templates, spec.Scenarios.Consumer.Topic)
+	}
+	if spec.Scenarios.Compression != nil {
+		templates = append(templates, spec.Scenarios.Compression.Topic)
+	}
+	if spec.Scenarios.Admin != nil {
+		for _, step := range spec.Scenarios.Admin.Steps {
+			if step.Op == "create_topics" {
+				templates = append(templates, step.Topic)
+			}
+		}
+	}
+	for _, template := range templates {
+		name := replaceRunID(template, runID)
+		if strings.Contains(template, "{{run_id}}") && !declared[name] {
+			add(name)
+		}
+	}
+	return names
+}
+
+// runGroups returns the consumer groups whose IDs are scoped to the run. A
+// fixed group ID may be shared with other runs, so it is left in place.
+func runGroups(spec *scenario.ScenarioFile, runID string) []string {
+	var templates []string
+	if cfg := spec.Scenarios.Consumer; cfg != nil && cfg.Mode != "partition" {
+		templates = append(templates, cfg.Group.ID)
+	}
+	if spec.Scenarios.Groups != nil {
+		for _, step := range spec.Scenarios.Groups.Steps {
+			templates = append(templates, step.Group)
+		}
+	}
+	var groups []string
+	seen := map[string]bool{}
+	for _, template := range templates {
+		if template != "" && !strings.Contains(template, "{{run_id}}") {
+			continue
+		}
+		group := resolvedGroupID(template, runID)
+		if !seen[group] {
+			seen[group] = true
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
@@ -0,0 +1,109 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package engine
+
+import (
+	"slices"
+	"testing"
+
+	"kaf6/internal/scenario"
+)
+
+func TestCleanupMode(t *testing.T) {
+	cases := []struct {
+		name string
+		spec scenario.ScenarioFile
+		want string
+	}{
+		{name: "default", want: "on_success"},
+		{name: "explicit", spec: scenario.ScenarioFile{Cleanup: "always"}, want: "always"},
+		{name: "produce phase", spec: scenario.ScenarioFile{Phase: "produce", Cleanup: "always"}, want: "never"},
+		{name: "verify phase", spec: scenario.ScenarioFile{Phase: "verify"}, want: "never"},
+		{name: "verify phase explicit", spec: scenario.ScenarioFile{Phase: "verify", Cleanup: "always"}, want: "always"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := cleanupMode(&tc.spec); got != tc.want {
+				t.Fatalf("got %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRunTopics(t *testing.T) {
+	spec := &scenario.ScenarioFile{
+		Topics: []scenario.TopicSpec{{Name: "kaf6-{{run_id}}"}, {Name: "shared"}},
+		Scenarios: scenario.ScenarioCollection{
+			Producer: &scenario.ProducerScenario{Topic: "kaf6-{{run_id}}"},
+			Consumer: &scenario.ConsumerScenario{Topic: "fixed"},
+			Admin: &scenario.AdminScenario{Steps: []scenario.AdminStep{
+				{Op: "create_topics", Topic: "acl-test-{{run_id}}"},
+				{Op: "delete_topics", Topic: "other-{{run_id}}"},
+			}},
+		},
+	}
+	topics := []TopicResult{{Name: "kaf6-r1"}, {Name: "shared", Existed: true}}
+	got := runTopics(spec, "r1", topics)
+	want := []string{"kaf6-r1", "acl-test-r1"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestRunGroups(t *testing.T) {
+	cases := []struct {
+		name      string
+		scenarios scenario.ScenarioCollection
+		want      []string
+	}{
+		{name: "no consumer"},
+		{
+			name:      "default group",
+			scenarios: scenario.ScenarioCollection{Consumer: &scenario.ConsumerScenario{}},
+			want:      []string{"kaf6-group-r1"},
+		},
+		{
+			name:      "fixed group",
+			scenarios: scenario.ScenarioCollection{Consumer: &scenario.ConsumerScenario{Group: scenario.GroupSpec{ID: "shared"}}},
+		},
+		{
+			name:      "partition mode",
+			scenarios: scenario.ScenarioCollection{Consumer: &scenario.ConsumerScenario{Mode: "partition"}},
+		},
+		{
+			name: "group steps",
+			scenarios: scenario.ScenarioCollection{
+				Consumer: &scenario.ConsumerScenario{Group: scenario.GroupSpec{ID: "g-{{run_id}}"}},
+				Groups: &scenario.GroupsScenario{Steps: []scenario.GroupStep{
+					{Op: "describe_groups", Group: "g-{{run_id}}"},
+					{Op: "delete_groups", Group: "h-{{run_id}}"},
+					{Op: "list_groups", Group: "fixed"},
+				}},
+			},
+			want: []string{"g-r1", "h-r1"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := runGroups(&scenario.ScenarioFile{Scenarios: tc.scenarios}, "r1")
+			if !slices.Equal(got, tc.want) {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
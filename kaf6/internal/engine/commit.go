@@ -0,0 +1,278 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package engine
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+
+	"kaf6/internal/metrics"
+	"kaf6/internal/scenario"
+)
+
+type CommitCheck struct {
+	Partition int32
+	Consumed  int64
+	Committed int64
+	Status    string
+}
+
+type ResumeResult struct {
+	Consumed   int64
+	Duplicates int64
+	Skipped    int64
+	Status     string
+}
+
+func commitOptions(mode string) ([]kgo.Opt, error) {
+	switch mode {
+	case "", "auto":
+		return nil, nil
+	case "sync", "async", "none":
+		return []kgo.Opt{kgo.DisableAutoCommit()}, nil
+	default:
+		return nil, fmt.Errorf("unknown commit mode: %s", mode)
+	}
+}
+
+// commitPolled commits what the last poll returned according to the commit
+// mode. Auto commits are left to franz-go.
+func commitPolled(ctx context.Context, client *kgo.Client, mode string, sum *metrics.Summary, debug bool) {
+	switch mode {
+	case "sync":
+		if err := client.CommitUncommittedOffsets(ctx); err != nil {
+			sum.AddError()
+			if debug {
+				fmt.Printf("consumer debug: commit: %v\n", err)
+			}
+		}
+	case "async":
+		client.CommitOffsets(ctx, client.UncommittedOffsets(), func(_ *kgo.Client, _ *kmsg.OffsetCommitRequest, _ *kmsg.OffsetCommitResponse, err error) {
+			if err != nil {
+				sum.AddError()
+				if debug {
+					fmt.Printf("consumer debug: async commit: %v\n", err)
+				}
+			}
+		})
+	}
+}
+
+// verifyCommits compares the group's committed offsets with the next offset
+// after the last consumed record of every partition. With commits disabled
+// nothing may be committed at all.
+func verifyCommits(ctx context.Context, brokers []string, groupID string, topic string, mode string, consumed map[int32]int64, sum *metrics.Summary) ([]CommitCheck, error) {
+	client, err := kgo.NewClient(kgo.SeedBrokers(brokers...))
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	offsets, err := kadm.NewClient(client).FetchOffsets(ctx, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("fetch committed offsets: %w", err)
+	}
+	committed := make(map[int32]int64)
+	offsets.Each(func(offset kadm.OffsetResponse) {
+		if offset.Topic == topic && offset.Err == nil {
+			committed[offset.Partition] = offset.At
+		}
+	})
+	return compareCommits(mode, consumed, committed, sum), nil
+}
+
+// compareCommits checks the committed offset of every consumed partition;
+// a partition without a commit counts as -1.
+func compareCommits(mode string, consumed map[int32]int64, committed map[int32]int64, sum *metrics.Summary) []CommitCheck {
+	checks := make([]CommitCheck, 0, len(consumed))
+	for partition, next := range consumed {
+		check := CommitCheck{Partition: partition, Consumed: next, Committed: -1, Status: "pass"}
+		if offset, ok := committed[partition]; ok {
+			check.Committed = offset
+		}
+		want := next
+		if mode == "none" {
+			want = -1
+		}
+		if check.Committed != want {
+			check.Status = "fail"
+			sum.AddCommitMismatch()
+		}
+		checks = append(checks, check)
+	}
+	sort.Slice(checks, func(i, j int) bool { return checks[i].Partition < checks[j].Partition })
+	return checks
+}
+
+// resumeState follows the resume consumer: seen is where the first
+// consumers stopped, next where each partition continues, target the end
+// offset to reach and remaining how many partitions have not reached it.
+type resumeState struct {
+	out       *ResumeResult
+	seen      map[int32]int64
+	next      map[int32]int64
+	target    map[int32]int64
+	first     map[int32]bool
+	remaining int
+}
+
+func newResumeState(commits []CommitCheck, ends map[int32]int64) *resumeState {
+	r := &resumeState{
+		out:    &ResumeResult{Status: "pass"},
+		seen:   make(map[int32]int64, len(commits)),
+		next:   make(map[int32]int64),
+		target: make(map[int32]int64),
+		first:  make(map[int32]bool),
+	}
+	for _, commit := range commits {
+		r.seen[commit.Partition] = commit.Consumed
+		r.next[commit.Partition] = commit.Committed
+	}
+	for partition, end := range ends {
+		r.target[partition] = end
+		if end > r.next[partition] {
+			r.remaining++
+		}
+	}
+	return r
+}
+
+// observe accounts one resumed record and reports whether the first
+// consumers had already received it.
+func (r *resumeState) observe(partition int32, offset int64) bool {
+	if !r.first[partition] {
+		r.first[partition] = true
+		if start, ok := r.next[partition]; ok && start >= 0 && offset > start {
+			r.out.Skipped += offset - start
+		}
+	}
+	r.out.Consumed++
+	duplicate := offset < r.seen[partition]
+	if duplicate {
+		r.out.Duplicates++
+	}
+	if offset+1 >= r.target[partition] && r.next[partition] < r.target[partition] {
+		r.remaining--
+	}
+	if offset+1 > r.next[partition] {
+		r.next[partition] = offset + 1
+	}
+	return duplicate
+}
+
+// finish settles the status once the resume consumer stopped.
+func (r *resumeState) finish() error {
+	if r.out.Duplicates > 0 || r.out.Skipped > 0 {
+		r.out.Status = "fail"
+	}
+	if r.remaining > 0 {
+		r.out.Status = "fail"
+		return fmt.Errorf("resume timeout: %d partitions short of the end offset", r.remaining)
+	}
+	return nil
+}
+
+// runResume starts a fresh consumer in the same group and reads up to the
+// current end of every partition. It must start exactly at the committed
+// offsets: records the first consumers already saw are duplicates, and a
+// first offset beyond the commit means records were skipped.
+func runResume(ctx context.Context, spec *scenario.ScenarioFile, cfg *scenario.ConsumerScenario, sum *metrics.Summary, runID string, protocol string, timeout time.Duration, commits []CommitCheck) (*ResumeResult, error) {
+	groupID := resolvedGroupID(cfg.Group.ID, runID)
+	topic := resolveTopic(cfg.Topic, spec.Topics, runID)
+	admin, err := kgo.NewClient(kgo.SeedBrokers(spec.Brokers...))
+	if err != nil {
+		return nil, err
+	}
+	ends, err := kadm.NewClient(admin).ListEndOffsets(ctx, topic)
+	admin.Close()
+	if err == nil {
+		err = ends.Error()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("list end offsets: %w", err)
+	}
+
+	endOffsets := make(map[int32]int64)
+	ends.Each(func(end kadm.ListedOffset) {
+		endOffsets[end.Partition] = end.Offset
+	})
+	state := newResumeState(commits, endOffsets)
+	// When the first consumers already read everything, the resume
+	// consumer has nothing to start from and would pass without a check.
+	if state.remaining == 0 {
+		state.out.Status = "fail"
+		return state.out, fmt.Errorf("resume not exercised: the first consumers read every partition to its end offset; set a limit below the produced records")
+	}
+
+	// A static member identity would be fenced or stuck behind the previous
+	// members' sessions, so the resume consumer always joins dynamically.
+	group := cfg.Group
+	group.InstanceID = ""
+	options, err := groupOptions(group, protocol, runID, 1, 0)
+	if err != nil {
+		return nil, err
+	}
+	commitOpts, _ := commitOptions(cfg.Commit)
+	options = append(options, commitOpts...)
+	options = append(options,
+		kgo.SeedBrokers(spec.Brokers...),
+		kgo.ClientID("kaf6-consumer-resume"),
+		kgo.ConsumerGroup(groupID),
+		kgo.ConsumeTopics(topic),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
+	)
+	client, err := kgo.NewClient(options...)
+	if err != nil {
+		return nil, err
+	}
+	debug := os.Getenv("KAF6_DEBUG") == "1"
+	defer closeClient(client, debug)
+
+	out := state.out
+	deadline := time.Now().Add(timeout)
+	for state.remaining > 0 && time.Now().Before(deadline) {
+		pollCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
+		fetches := client.PollFetches(pollCtx)
+		cancel()
+		if ctx.Err() != nil {
+			break
+		}
+		if errs := fetches.Errors(); len(errs) > 0 && pollCtx.Err() == nil {
+			return out, fmt.Errorf("resume fetch errors: %+v", errs)
+		}
+		fetches.EachRecord(func(record *kgo.Record) {
+			observeConsumed(sum, nil, record)
+			if state.observe(record.Partition, record.Offset) {
+				sum.AddDuplicate()
+			}
+		})
+	}
+	if cfg.Commit == "sync" || cfg.Commit == "async" {
+		commitPolled(ctx, client, "sync", sum, debug)
+	}
+	if out.Skipped > 0 {
+		sum.AddError()
+	}
+	return out, state.finish()
+}
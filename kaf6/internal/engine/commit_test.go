@@ -0,0 +1,133 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package engine
+
+import (
+	"reflect"
+	"testing"
+
+	"kaf6/internal/metrics"
+)
+
+func TestCompareCommits(t *testing.T) {
+	consumed := map[int32]int64{0: 10, 1: 5, 2: 7}
+	cases := []struct {
+		name       string
+		mode       string
+		committed  map[int32]int64
+		statuses   []string
+		mismatches int64
+	}{
+		{name: "all committed", mode: "sync", committed: map[int32]int64{0: 10, 1: 5, 2: 7}, statuses: []string{"pass", "pass", "pass"}},
+		{name: "behind and missing", mode: "auto", committed: map[int32]int64{0: 8, 1: 5}, statuses: []string{"fail", "pass", "fail"}, mismatches: 2},
+		{name: "none commits nothing", mode: "none", committed: map[int32]int64{}, statuses: []string{"pass", "pass", "pass"}},
+		{name: "none but committed", mode: "none", committed: map[int32]int64{1: 5}, statuses: []string{"pass", "fail", "pass"}, mismatches: 1},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			sum := &metrics.Summary{}
+			checks := compareCommits(tc.mode, consumed, tc.committed, sum)
+			var statuses []string
+			for i, check := range checks {
+				if check.Partition != int32(i) {
+					t.Fatalf("checks not sorted: %+v", checks)
+				}
+				statuses = append(statuses, check.Status)
+			}
+			if !reflect.DeepEqual(statuses, tc.statuses) {
+				t.Errorf("statuses = %v, want %v", statuses, tc.statuses)
+			}
+			if sum.CommitMismatches != tc.mismatches {
+				t.Errorf("mismatches = %d, want %d", sum.CommitMismatches, tc.mismatches)
+			}
+		})
+	}
+}
+
+func TestResumeState(t *testing.T) {
+	commits := []CommitCheck{
+		{Partition: 0, Consumed: 4, Committed: 4},
+		{Partition: 1, Consumed: 6, Committed: 6},
+	}
+	ends := map[int32]int64{0: 8, 1: 6, 2: 3}
+	type fetch struct {
+		partition int32
+		offset    int64
+	}
+	cases := []struct {
+		name       string
+		fetches    []fetch
+		duplicates int64
+		skipped    int64
+		status     string
+		wantErr    bool
+	}{
+		{
+			name:    "starts at the commit",
+			fetches: []fetch{{0, 4}, {0, 5}, {0, 6}, {0, 7}, {2, 0}, {2, 1}, {2, 2}},
+			status:  "pass",
+		},
+		{
+			name:       "redelivers consumed records",
+			fetches:    []fetch{{0, 2}, {0, 3}, {0, 4}, {0, 5}, {0, 6}, {0, 7}, {2, 0}, {2, 1}, {2, 2}},
+			duplicates: 2,
+			status:     "fail",
+		},
+		{
+			name:    "skips past the commit",
+			fetches: []fetch{{0, 6}, {0, 7}, {2, 0}, {2, 1}, {2, 2}},
+			skipped: 2,
+			status:  "fail",
+		},
+		{
+			name:    "stops short of the end",
+			fetches: []fetch{{0, 4}, {2, 0}},
+			status:  "fail",
+			wantErr: true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			state := newResumeState(commits, ends)
+			if state.remaining != 2 {
+				t.Fatalf("remaining = %d, want 2", state.remaining)
+			}
+			for _, f := range tc.fetches {
+				state.observe(f.partition, f.offset)
+			}
+			err := state.finish()
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("finish error = %v, want error %v", err, tc.wantErr)
+			}
+			out := state.out
+			if out.Duplicates != tc.duplicates || out.Skipped != tc.skipped || out.Status != tc.status {
+				t.Errorf("duplicates=%d skipped=%d status=%s, want %d %d %s", out.Duplicates, out.Skipped, out.Status, tc.duplicates, tc.skipped, tc.status)
+			}
+			if out.Consumed != int64(len(tc.fetches)) {
+				t.Errorf("consumed = %d, want %d", out.Consumed, len(tc.fetches))
+			}
+		})
+	}
+}
+
+func TestResumeStateNothingLeft(t *testing.T) {
+	commits := []CommitCheck{{Partition: 0, Consumed: 8, Committed: 8}}
+	if state := newResumeState(commits, map[int32]int64{0: 8}); state.remaining != 0 {
+		t.Fatalf("remaining = %d, want 0", state.remaining)
+	}
+}
@@ -0,0 +1,244 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// produceLog remembers when the producer step ran and the partition and
+// offset of every record it got an acknowledgement for, so a consumer can wait
+// for exactly those and measure how long it took to catch up. With manifest
+// set it also keeps each record's ID and value hash for the produce phase.
+type produceLog struct {
+	start    time.Time
+	manifest bool
+
+	mu      sync.Mutex
+	end     time.Time
+	lastAck time.Time
+	offsets map[string]map[int32][]int64
+	records []ManifestRecord
+	ends    map[string]map[int32]int64
+}
+
+func (l *produceLog) add(record *kgo.Record) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.offsets == nil {
+		l.offsets = make(map[string]map[int32][]int64)
+	}
+	if l.offsets[record.Topic] == nil {
+		l.offsets[record.Topic] = make(map[int32][]int64)
+	}
+	l.offsets[record.Topic][record.Partition] = append(l.offsets[record.Topic][record.Partition], record.Offset)
+	l.lastAck = time.Now()
+	if l.manifest {
+		l.records = append(l.records, ManifestRecord{
+			ID:        recordID(record),
+			Partition: record.Partition,
+			Offset:    record.Offset,
+			Hash:      valueHash(record.Value),
+		})
+	}
+}
+
+// finish marks the producer step as done.
+func (l *produceLog) finish() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.end = time.Now()
+}
+
+// setEnds records a topic's end offsets as listed when the producer step
+// finished.
+func (l *produceLog) setEnds(topic string, ends map[int32]int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.ends == nil {
+		l.ends = make(map[string]map[int32]int64)
+	}
+	l.ends[topic] = ends
+}
+
+// drainStart reports when consumers could first have caught up: the last
+// acknowledgement, or the end of the producer step when nothing was acked.
+// It is zero while the producer step is still running.
+func (l *produceLog) drainStart() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.end.IsZero() || l.lastAck.IsZero() {
+		return l.end
+	}
+	return l.lastAck
+}
+
+func (l *produceLog) sortedRecords() []ManifestRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	records := append([]ManifestRecord(nil), l.records...)
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Partition != records[j].Partition {
+			return records[i].Partition < records[j].Partition
+		}
+		return records[i].Offset < records[j].Offset
+	})
+	return records
+}
+
+// completion decides when the consumer step is done and records which
+// condition ended it. Records are observed from every client goroutine.
+type completion struct {
+	until  string
+	limit  int64
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	endedBy string
+	total   int64
+	pending map[int32]map[int64]bool
+	missing int
+	targets map[int32]int64
+	below   int
+}
+
+func newCompletion(until string, limit int64, produced *produceLog, topic string, starts []PartitionOffset, ends []PartitionOffset, cancel context.CancelFunc) (*completion, error) {
+	c := &completion{until: until, limit: limit, cancel: cancel}
+	switch until {
+	case "limit", "duration":
+	case "all_ids":
+		produced.mu.Lock()
+		defer produced.mu.Unlock()
+		c.pending = make(map[int32]map[int64]bool)
+		for partition, offsets := range produced.offsets[topic] {
+			c.pending[partition] = make(map[int64]bool, len(offsets))
+			for _, offset := range offsets {
+				c.pending[partition][offset] = true
+			}
+			c.missing += len(offsets)
+		}
+		if c.missing == 0 {
+			return nil, fmt.Errorf("consumer until all_ids needs a producer step writing to %s", topic)
+		}
+	case "hwm":
+		// The targets are the end offsets listed when the producer step
+		// finished, so records written after it do not move them. Without a
+		// producer step the ends listed at consumer start stand in.
+		produced.mu.Lock()
+		targets := produced.ends[topic]
+		produced.mu.Unlock()
+		if targets == nil {
+			targets = make(map[int32]int64, len(ends))
+			for _, end := range ends {
+				targets[end.Partition] = end.Offset
+			}
+		}
+		from := make(map[int32]int64, len(starts))
+		for _, start := range starts {
+			from[start.Partition] = start.Offset
+		}
+		c.targets = make(map[int32]int64, len(targets))
+		for partition, end := range targets {
+			if end > from[partition] {
+				c.targets[partition] = end
+				c.below++
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown consumer until: %s", until)
+	}
+	return c, nil
+}
+
+// observe counts one consumed record and ends the step once the condition
+// is met.
+func (c *completion) observe(partition int32, offset int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.total++
+	switch c.until {
+	case "limit":
+		if c.total >= c.limit {
+			c.finishLocked("limit")
+		}
+	case "all_ids":
+		if c.pending[partition][offset] {
+			delete(c.pending[partition], offset)
+			c.missing--
+		}
+		if c.missing == 0 {
+			c.finishLocked("all_ids")
+		}
+	case "hwm":
+		if target, ok := c.targets[partition]; ok && offset+1 >= target {
+			delete(c.targets, partition)
+			c.below--
+		}
+		if c.below == 0 {
+			c.finishLocked("hwm")
+		}
+	}
+}
+
+func (c *completion) finish(reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.finishLocked(reason)
+}
+
+func (c *completion) finishLocked(reason string) {
+	if c.endedBy == "" {
+		c.endedBy = reason
+	}
+	c.cancel()
+}
+
+func (c *completion) done() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.endedBy != ""
+}
+
+// err explains why the step did not reach its condition.
+func (c *completion) err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.endedBy == c.until {
+		return nil
+	}
+	switch c.until {
+	case "all_ids":
+		return fmt.Errorf("catch-up incomplete: %d acknowledged records not consumed (ended by %s)", c.missing, c.endedBy)
+	case "hwm":
+		return fmt.Errorf("catch-up incomplete: %d partitions below the produce-end high-water mark (ended by %s)", c.below, c.endedBy)
+	case "duration":
+		return fmt.Errorf("consume ended early by %s", c.endedBy)
+	default:
+		reason := c.endedBy
+		if reason == "idle" {
+			reason = "idle timeout"
+		}
+		return fmt.Errorf("consume %s: got %d of %d", reason, c.total, c.limit)
+	}
+}
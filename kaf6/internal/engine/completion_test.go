@@ -0,0 +1,83 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package engine
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCompletionHWMTargets(t *testing.T) {
+	starts := []PartitionOffset{{Partition: 0, Offset: 0}, {Partition: 1, Offset: 4}}
+	consumerEnds := []PartitionOffset{{Partition: 0, Offset: 9}, {Partition: 1, Offset: 9}}
+	tests := []struct {
+		name     string
+		produced map[int32]int64
+		want     map[int32]int64
+	}{
+		// Records written after the producer step finished must not move
+		// the targets.
+		{"produce end", map[int32]int64{0: 5, 1: 4}, map[int32]int64{0: 5}},
+		{"no producer step", nil, map[int32]int64{0: 9, 1: 9}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			produced := &produceLog{}
+			if tt.produced != nil {
+				produced.setEnds("t", tt.produced)
+			}
+			c, err := newCompletion("hwm", 0, produced, "t", starts, consumerEnds, func() {})
+			if err != nil {
+				t.Fatalf("newCompletion: %v", err)
+			}
+			if len(c.targets) != len(tt.want) || c.below != len(tt.want) {
+				t.Fatalf("targets = %v below = %d, want %v", c.targets, c.below, tt.want)
+			}
+			for partition, end := range tt.want {
+				if c.targets[partition] != end {
+					t.Fatalf("target p%d = %d, want %d", partition, c.targets[partition], end)
+				}
+			}
+		})
+	}
+}
+
+func TestCompletionHWMObserve(t *testing.T) {
+	produced := &produceLog{}
+	produced.setEnds("t", map[int32]int64{0: 3, 1: 2})
+	ctx, cancel := context.WithCancel(context.Background())
+	c, err := newCompletion("hwm", 0, produced, "t", nil, nil, cancel)
+	if err != nil {
+		t.Fatalf("newCompletion: %v", err)
+	}
+	c.observe(0, 2)
+	c.observe(1, 0)
+	if c.done() {
+		t.Fatal("done before partition 1 reached its target")
+	}
+	if err := c.err(); err == nil {
+		t.Fatal("err = nil before the target was reached")
+	}
+	c.observe(1, 1)
+	if !c.done() || ctx.Err() == nil {
+		t.Fatal("not done after every partition reached its target")
+	}
+	if c.endedBy != "hwm" || c.err() != nil {
+		t.Fatalf("endedBy = %q err = %v", c.endedBy, c.err())
+	}
+}
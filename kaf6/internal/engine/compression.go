@@ -0,0 +1,276 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package engine
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"kaf6/internal/metrics"
+	"kaf6/internal/scenario"
+)
+
+// codecNames is indexed by the Kafka record batch compression attribute.
+var codecNames = []string{"none", "gzip", "snappy", "lz4", "zstd"}
+
+type CodecResult struct {
+	Codec             string
+	Partition         int32
+	Produced          int64
+	Consumed          int64
+	Mismatched        int64
+	UncompressedBytes int64
+	CompressedBytes   int64
+	StoredCodec       string
+	Status            string
+}
+
+func compressionCodec(name string) (kgo.CompressionCodec, error) {
+	switch name {
+	case "", "none":
+		return kgo.NoCompression(), nil
+	case "gzip":
+		return kgo.GzipCompression(), nil
+	case "snappy":
+		return kgo.SnappyCompression(), nil
+	case "lz4":
+		return kgo.Lz4Compression(), nil
+	case "zstd":
+		return kgo.ZstdCompression(), nil
+	default:
+		return kgo.CompressionCodec{}, fmt.Errorf("unknown compression codec: %s", name)
+	}
+}
+
+func codecName(attr uint8) string {
+	if int(attr) < len(codecNames) {
+		return codecNames[attr]
+	}
+	return fmt.Sprintf("unknown(%d)", attr)
+}
+
+// batchRecorder collects produce and fetch batch metrics per partition. The
+// compression matrix writes each codec to its own partition, so the partition
+// identifies which codec a batch belongs to.
+type batchRecorder struct {
+	mu           sync.Mutex
+	uncompressed map[int32]int64
+	compressed   map[int32]int64
+	stored       map[int32]string
+}
+
+func newBatchRecorder() *batchRecorder {
+	return &batchRecorder{
+		uncompressed: make(map[int32]int64),
+		compressed:   make(map[int32]int64),
+		stored:       make(map[int32]string),
+	}
+}
+
+func (r *batchRecorder) OnProduceBatchWritten(_ kgo.BrokerMetadata, _ string, partition int32, m kgo.ProduceBatchMetrics) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.uncompressed[partition] += int64(m.UncompressedBytes)
+	r.compressed[partition] += int64(m.CompressedBytes)
+}
+
+func (r *batchRecorder) OnFetchBatchRead(_ kgo.BrokerMetadata, _ string, partition int32, m kgo.FetchBatchMetrics) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	name := codecName(m.CompressionType)
+	if prev, ok := r.stored[partition]; ok && prev != name {
+		name = prev + "+" + name
+	}
+	r.stored[partition] = name
+}
+
+func runCompressionMatrix(ctx context.Context, spec *scenario.ScenarioFile, sum *metrics.Summary, runID string) ([]CodecResult, error) {
+	cfg := spec.Scenarios.Compression
+	codecs := cfg.Codecs
+	if len(codecs) == 0 {
+		codecs = codecNames
+	}
+	if cfg.Messages <= 0 {
+		cfg.Messages = 10
+	}
+	topic := resolveTopic(cfg.Topic, spec.Topics, runID)
+	if topic == "" {
+		return nil, fmt.Errorf("compression topic is required")
+	}
+	timeout := 30 * time.Second
+	if cfg.Timeout != "" {
+		if parsed, err := time.ParseDuration(cfg.Timeout); err == nil {
+			timeout = parsed
+		}
+	}
+	// A corpus carries its own keys, which the matrix would replace with
+	// the ones it uses to match records back to their codec.
+	if cfg.Value.Mode == "file" || (cfg.Value.Mode == "" && cfg.Value.Schema == nil && cfg.Value.File != "") {
+		return nil, fmt.Errorf("compression payload: value.file is not supported; use a generated value")
+	}
+	payload, err := newProducerPayload(ctx, spec, cfg.Value, topic, runID)
+	if err != nil {
+		return nil, fmt.Errorf("compression payload: %w", err)
+	}
+	defer payload.close()
+	if err := checkPartitionCount(ctx, spec.Brokers, topic, len(codecs)); err != nil {
+		return nil, err
+	}
+
+	verbose := os.Getenv("KAF6_VERBOSE") == "1"
+	recorder := newBatchRecorder()
+	results := make([]CodecResult, len(codecs))
+	// expected only holds acknowledged records, so a failed produce is not
+	// reported as missing on the consume side.
+	var expectedMu sync.Mutex
+	expected := make(map[string][]byte)
+	for i, name := range codecs {
+		results[i] = CodecResult{Codec: name, Partition: int32(i)}
+		codec, err := compressionCodec(name)
+		if err != nil {
+			return nil, err
+		}
+		client, err := kgo.NewClient(
+			kgo.SeedBrokers(spec.Brokers...),
+			kgo.DisableIdempotentWrite(),
+			kgo.ProducerBatchCompression(codec),
+			kgo.RecordPartitioner(kgo.ManualPartitioner()),
+			kgo.WithHooks(recorder),
+		)
+		if err != nil {
+			return nil, err
+		}
+		state := newTemplateState(runID, i, cfg.Value.Seed)
+		var produced atomic.Int64
+		var wg sync.WaitGroup
+		for j := 0; j < cfg.Messages; j++ {
+			state.seq = int64(j)
+			value, err := payload.build(state)
+			if err != nil {
+				sum.AddError()
+				continue
+			}
+			key := fmt.Sprintf("%s-%d", name, j)
+			start := time.Now()
+			wg.Add(1)
+			client.Produce(ctx, &kgo.Record{Topic: topic, Partition: int32(i), Key: []byte(key), Value: value}, func(_ *kgo.Record, err error) {
+				defer wg.Done()
+				if err != nil {
+					sum.AddError()
+					if verbose {
+						fmt.Printf("compression[%s]: error: %v\n", name, err)
+					}
+					return
+				}
+				produced.Add(1)
+				sum.AddProduce(time.Since(start))
+				expectedMu.Lock()
+				expected[key] = value
+				expectedMu.Unlock()
+			})
+		}
+		wg.Wait()
+		client.Close()
+		results[i].Produced = produced.Load()
+		if verbose {
+			fmt.Printf("compression: produced codec=%s partition=%d\n", name, i)
+		}
+	}
+
+	client, err := kgo.NewClient(
+		kgo.SeedBrokers(spec.Brokers...),
+		kgo.ConsumeTopics(topic),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
+		kgo.WithHooks(recorder),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	deadline := time.Now().Add(timeout)
+	seen := make(map[string]bool, len(expected))
+	for len(seen) < len(expected) && time.Now().Before(deadline) {
+		pollCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
+		fetches := client.PollFetches(pollCtx)
+		cancel()
+		if errs := fetches.Errors(); len(errs) > 0 && pollCtx.Err() == nil {
+			return results, fmt.Errorf("fetch errors: %+v", errs)
+		}
+		fetches.EachRecord(func(record *kgo.Record) {
+			key := string(record.Key)
+			want, ok := expected[key]
+			if !ok || seen[key] || int(record.Partition) >= len(results) {
+				return
+			}
+			seen[key] = true
+			observeConsumed(sum, nil, record)
+			result := &results[record.Partition]
+			if !bytes.Equal(record.Value, want) {
+				result.Mismatched++
+				sum.AddError()
+				return
+			}
+			result.Consumed++
+		})
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	for i := range results {
+		result := &results[i]
+		result.UncompressedBytes = recorder.uncompressed[result.Partition]
+		result.CompressedBytes = recorder.compressed[result.Partition]
+		result.StoredCodec = recorder.stored[result.Partition]
+		result.Status = "pass"
+		if result.Consumed != result.Produced || result.Mismatched > 0 {
+			result.Status = "fail"
+		}
+	}
+	if len(seen) < len(expected) {
+		return results, fmt.Errorf("compression matrix: got %d of %d records", len(seen), len(expected))
+	}
+	return results, nil
+}
+
+func checkPartitionCount(ctx context.Context, brokers []string, topic string, want int) error {
+	client, err := kgo.NewClient(kgo.SeedBrokers(brokers...))
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	topics, err := kadm.NewClient(client).ListTopics(ctx, topic)
+	if err != nil {
+		return err
+	}
+	detail, ok := topics[topic]
+	if !ok || detail.Err != nil {
+		return fmt.Errorf("topic %s not found", topic)
+	}
+	if len(detail.Partitions) < want {
+		return fmt.Errorf("topic %s has %d partitions, compression matrix needs %d", topic, len(detail.Partitions), want)
+	}
+	return nil
+}
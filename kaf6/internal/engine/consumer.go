@@ -0,0 +1,570 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package engine
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"kaf6/internal/metrics"
+	"kaf6/internal/scenario"
+)
+
+type ConsumerResult struct {
+	Protocol         string
+	ProtocolFallback bool
+	Balancer         string
+	InstanceID       string
+	EndedBy          string
+	Commit           string
+	Commits          []CommitCheck
+	Resume           *ResumeResult
+	StartMode        string
+	ResolvedOffsets  []PartitionOffset
+	StartOffsets     []PartitionOffset
+	Clients          []ConsumerClientResult
+	Rebalances       []RebalanceEvent
+	Lag              *LagResult
+	Corrupt          []CorruptRecord
+	ClockSkew        []ClockSkew
+}
+
+type RebalanceEvent struct {
+	Time       time.Time
+	Client     int
+	Kind       string
+	Generation int32
+	Partitions []int32
+}
+
+// rebalanceLog records the group lifecycle as seen by every client. Staggered
+// joins bump the generation several times while the clients start, and a
+// cooperative join takes one more generation to hand over the moved
+// partitions, so generation bumps alone are not rebalances. A rebalance is
+// counted once per generation in which a client loses partitions it held,
+// and only after every client has received its first assignment.
+type rebalanceLog struct {
+	sum     *metrics.Summary
+	clients int
+
+	mu      sync.Mutex
+	events  []RebalanceEvent
+	joined  map[int]bool
+	counted int32
+	stopped bool
+}
+
+func newRebalanceLog(sum *metrics.Summary, clients int) *rebalanceLog {
+	return &rebalanceLog{sum: sum, clients: clients, joined: make(map[int]bool), counted: -1}
+}
+
+func (l *rebalanceLog) record(client int, kind string, generation int32, moved map[string][]int32) {
+	var partitions []int32
+	for _, ps := range moved {
+		partitions = append(partitions, ps...)
+	}
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i] < partitions[j] })
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.stopped {
+		return
+	}
+	l.events = append(l.events, RebalanceEvent{Time: time.Now(), Client: client, Kind: kind, Generation: generation, Partitions: partitions})
+	switch {
+	case kind == "assigned":
+		l.joined[client] = true
+	case len(partitions) > 0 && len(l.joined) >= l.clients && generation > l.counted:
+		l.sum.AddRebalance()
+		l.counted = generation
+	}
+	if os.Getenv("KAF6_VERBOSE") == "1" {
+		fmt.Printf("consumer[%d]: %s generation=%d partitions=%v\n", client, kind, generation, partitions)
+	}
+}
+
+// stop ignores the revokes caused by closing the clients at the end of the
+// run; leaving the group is not churn.
+func (l *rebalanceLog) stop() []RebalanceEvent {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.stopped = true
+	return l.events
+}
+
+type ConsumerClientResult struct {
+	Client     int
+	Consumed   int64
+	Partitions []int32
+	Idle       time.Duration
+}
+
+// consumerClient is one consumer in the group, or one owner of a partition
+// slice in partition mode. The assignment is updated from the rebalance
+// callbacks, which run on a different goroutine than the poll loop.
+type consumerClient struct {
+	id     int
+	client *kgo.Client
+
+	mu       sync.Mutex
+	assigned map[int32]bool
+	consumed int64
+	idle     time.Duration
+	next     map[int32]int64
+}
+
+func (c *consumerClient) assign(assigned map[string][]int32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, partitions := range assigned {
+		for _, partition := range partitions {
+			c.assigned[partition] = true
+		}
+	}
+}
+
+func (c *consumerClient) revoke(revoked map[string][]int32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, partitions := range revoked {
+		for _, partition := range partitions {
+			delete(c.assigned, partition)
+		}
+	}
+}
+
+func (c *consumerClient) result() ConsumerClientResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	partitions := make([]int32, 0, len(c.assigned))
+	for partition := range c.assigned {
+		partitions = append(partitions, partition)
+	}
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i] < partitions[j] })
+	return ConsumerClientResult{Client: c.id, Consumed: c.consumed, Partitions: partitions, Idle: c.idle}
+}
+
+// runConsumer runs the consumer step. lag is the sampler started with the
+// producer, or nil to start one with the consumer.
+func runConsumer(ctx context.Context, spec *scenario.ScenarioFile, sum *metrics.Summary, runID string, produced *produceLog, lag *lagSampler) (*ConsumerResult, error) {
+	cfg := spec.Scenarios.Consumer
+	if cfg.Clients <= 0 {
+		cfg.Clients = 1
+	}
+	if cfg.Limit <= 0 {
+		cfg.Limit = 1
+	}
+	if cfg.Until == "" {
+		cfg.Until = "limit"
+	}
+	groupID := resolvedGroupID(cfg.Group.ID, runID)
+	topic := resolveTopic(cfg.Topic, spec.Topics, runID)
+	if topic == "" {
+		return nil, fmt.Errorf("consumer topic is required")
+	}
+	headerSpecs, err := parseHeaders(cfg.Headers)
+	if err != nil {
+		return nil, fmt.Errorf("consumer headers: %w", err)
+	}
+	expectedHeaders := headerChecks(headerSpecs, runID)
+	checksum := cfg.Checksum
+	if checksum == "" && spec.Scenarios.Producer != nil {
+		checksum = spec.Scenarios.Producer.Checksum
+	}
+	switch checksum {
+	case "none":
+		checksum = ""
+	case "", "header", "field":
+	default:
+		return nil, fmt.Errorf("unknown checksum mode: %s", checksum)
+	}
+	var schema *schemaCodec
+	if cfg.Schema != nil {
+		schema, err = newSchemaCodec(ctx, cfg.Schema, spec.Dir, topic, runID)
+		if err != nil {
+			return nil, fmt.Errorf("consumer schema: %w", err)
+		}
+	}
+	timeout := 30 * time.Second
+	if cfg.Timeout != "" {
+		if parsed, err := time.ParseDuration(cfg.Timeout); err == nil {
+			timeout = parsed
+		}
+	}
+	pollTimeout := 1 * time.Second
+	if cfg.PollTimeout != "" {
+		if parsed, err := time.ParseDuration(cfg.PollTimeout); err == nil {
+			pollTimeout = parsed
+		}
+	}
+	idleTimeout := 15 * time.Second
+	if cfg.IdleTimeout != "" {
+		if parsed, err := time.ParseDuration(cfg.IdleTimeout); err == nil {
+			idleTimeout = parsed
+		}
+	}
+	// A fixed-duration run replaces the timeout; going idle does not end it.
+	if cfg.Until == "duration" {
+		parsed, err := time.ParseDuration(cfg.Duration)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("consumer until duration needs a duration")
+		}
+		timeout = parsed
+		idleTimeout = parsed
+	}
+	start, err := parseStartOffset(cfg.Offset, produced.start)
+	if err != nil {
+		return nil, err
+	}
+	startOffsets, endOffsets, err := start.resolve(ctx, spec.Brokers, topic)
+	if err != nil {
+		return nil, fmt.Errorf("resolve consumer offset: %w", err)
+	}
+	commit := cfg.Commit
+	if commit == "" {
+		commit = "auto"
+	}
+	commitOpts, err := commitOptions(commit)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Resume && (commit == "none" || cfg.Mode == "partition") {
+		return nil, fmt.Errorf("consumer resume needs a consumer group that commits offsets")
+	}
+	out := &ConsumerResult{Commit: commit, StartMode: start.kind, ResolvedOffsets: startOffsets}
+	first := &firstFetched{offsets: make(map[int32]int64)}
+	rebalances := newRebalanceLog(sum, cfg.Clients)
+
+	// In partition mode each client owns a fixed share of the partitions and
+	// starts exactly at the resolved offsets.
+	var owned []map[int32]kgo.Offset
+	switch cfg.Mode {
+	case "", "group":
+		out.Protocol, out.ProtocolFallback, err = groupProtocol(ctx, spec.Brokers, cfg.Group)
+		if err != nil {
+			return nil, err
+		}
+		out.Balancer = cfg.Group.Balancer
+		out.InstanceID = replaceRunID(cfg.Group.InstanceID, runID)
+	case "partition":
+		owned = make([]map[int32]kgo.Offset, cfg.Clients)
+		for i, resolved := range startOffsets {
+			idx := i % cfg.Clients
+			if owned[idx] == nil {
+				owned[idx] = make(map[int32]kgo.Offset)
+			}
+			owned[idx][resolved.Partition] = kgo.NewOffset().At(resolved.Offset)
+		}
+	default:
+		return nil, fmt.Errorf("unknown consumer mode: %s", cfg.Mode)
+	}
+
+	clients := make([]*consumerClient, cfg.Clients)
+	for i := range clients {
+		c := &consumerClient{id: i, assigned: make(map[int32]bool), next: make(map[int32]int64)}
+		clients[i] = c
+		options := []kgo.Opt{
+			kgo.SeedBrokers(spec.Brokers...),
+			kgo.ClientID(fmt.Sprintf("kaf6-consumer-%d", i)),
+			kgo.DisableIdempotentWrite(),
+			kgo.AllowAutoTopicCreation(),
+		}
+		if owned != nil {
+			if len(owned[i]) == 0 {
+				continue
+			}
+			for partition := range owned[i] {
+				c.assigned[partition] = true
+			}
+			options = append(options, kgo.ConsumePartitions(map[string]map[int32]kgo.Offset{topic: owned[i]}))
+		} else {
+			group, err := groupOptions(cfg.Group, out.Protocol, runID, cfg.Clients, i)
+			if err != nil {
+				closeConsumers(clients, false)
+				return nil, err
+			}
+			options = append(options, group...)
+			options = append(options, commitOpts...)
+			options = append(options,
+				kgo.ConsumerGroup(groupID),
+				kgo.ConsumeTopics(topic),
+				kgo.BlockRebalanceOnPoll(),
+				kgo.ConsumeResetOffset(start.kgoOffset()),
+				kgo.OnPartitionsAssigned(func(_ context.Context, cl *kgo.Client, assigned map[string][]int32) {
+					c.assign(assigned)
+					_, generation := cl.GroupMetadata()
+					rebalances.record(c.id, "assigned", generation, assigned)
+				}),
+				kgo.OnPartitionsRevoked(func(ctx context.Context, cl *kgo.Client, revoked map[string][]int32) {
+					// Replacing the revoke callback drops franz-go's own
+					// commit on revoke, so every committing mode commits
+					// here before the partitions move.
+					if commit != "none" {
+						commitPolled(ctx, cl, "sync", sum, false)
+					}
+					c.revoke(revoked)
+					_, generation := cl.GroupMetadata()
+					rebalances.record(c.id, "revoked", generation, revoked)
+				}),
+				kgo.OnPartitionsLost(func(_ context.Context, cl *kgo.Client, lost map[string][]int32) {
+					c.revoke(lost)
+					_, generation := cl.GroupMetadata()
+					rebalances.record(c.id, "lost", generation, lost)
+				}),
+			)
+		}
+		if os.Getenv("KAF6_DEBUG") != "0" {
+			options = append(options, kgo.WithLogger(newDebugLogger(fmt.Sprintf("consumer[%d]", i))))
+		}
+		c.client, err = kgo.NewClient(options...)
+		if err != nil {
+			closeConsumers(clients, false)
+			return nil, err
+		}
+	}
+
+	debug := os.Getenv("KAF6_DEBUG") == "1"
+	if debug {
+		fmt.Printf("consumer debug: group=%s topic=%s clients=%d until=%s limit=%d timeout=%s\n", groupID, topic, cfg.Clients, cfg.Until, cfg.Limit, timeout)
+	}
+	consumeCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	until, err := newCompletion(cfg.Until, int64(cfg.Limit), produced, topic, startOffsets, endOffsets, cancel)
+	if err != nil {
+		closeConsumers(clients, debug)
+		return nil, err
+	}
+	position := func() map[int32]int64 {
+		next := make(map[int32]int64, len(startOffsets))
+		for _, start := range startOffsets {
+			next[start.Partition] = start.Offset
+		}
+		for _, c := range clients {
+			c.mu.Lock()
+			for partition, offset := range c.next {
+				next[partition] = max(next[partition], offset)
+			}
+			c.mu.Unlock()
+		}
+		return next
+	}
+	if lag == nil {
+		lag = startLag(ctx, spec.Brokers, topic, lagInterval(cfg), produced, sum)
+	}
+	lag.attach(ctx, position)
+	var total atomic.Int64
+	var lastRecord atomic.Int64
+	lastRecord.Store(time.Now().UnixNano())
+	var errMu sync.Mutex
+	var firstErr error
+	var corruptMu sync.Mutex
+	skew := &skewLog{}
+
+	var wg sync.WaitGroup
+	for _, c := range clients {
+		if c.client == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(c *consumerClient) {
+			defer wg.Done()
+			for !until.done() && consumeCtx.Err() == nil {
+				if time.Since(time.Unix(0, lastRecord.Load())) > idleTimeout {
+					if debug {
+						fmt.Printf("consumer debug: client=%d idle timeout reached\n", c.id)
+					}
+					return
+				}
+				pollStart := time.Now()
+				pollCtx, pollCancel := context.WithTimeout(consumeCtx, pollTimeout)
+				fetches := c.client.PollFetches(pollCtx)
+				pollCancel()
+				pollLatency := time.Since(pollStart)
+				if consumeCtx.Err() != nil {
+					c.client.AllowRebalance()
+					return
+				}
+				if pollCtx.Err() == context.DeadlineExceeded {
+					c.mu.Lock()
+					c.idle += pollLatency
+					c.mu.Unlock()
+					c.client.AllowRebalance()
+					continue
+				}
+				if errs := fetches.Errors(); len(errs) > 0 {
+					sum.AddError()
+					if debug {
+						fmt.Printf("consumer debug: client=%d fetch errors: %+v\n", c.id, errs)
+					}
+					errMu.Lock()
+					if firstErr == nil {
+						firstErr = fmt.Errorf("fetch errors: %+v", errs)
+					}
+					errMu.Unlock()
+					until.finish("error")
+					return
+				}
+				records := 0
+				next := make(map[int32]int64)
+				fetches.EachRecord(func(record *kgo.Record) {
+					records++
+					next[record.Partition] = record.Offset + 1
+					first.observe(record.Partition, record.Offset)
+					received := total.Add(1)
+					sum.AddConsumePoll(pollLatency)
+					observeConsumed(sum, skew, record)
+					if err := compareHeaders(expectedHeaders, record.Headers); err != nil {
+						sum.AddHeaderMismatch()
+						if debug {
+							fmt.Printf("consumer debug: partition=%d offset=%d %v\n", record.Partition, record.Offset, err)
+						}
+					}
+					if schema != nil {
+						if err := schema.validate(ctx, record.Value); err != nil {
+							sum.AddSchemaError()
+							if debug {
+								fmt.Printf("consumer debug: partition=%d offset=%d schema: %v\n", record.Partition, record.Offset, err)
+							}
+						}
+					}
+					if embedded, actual, ok := verifyChecksum(record, checksum); ok && embedded != actual {
+						sum.AddCorrupt()
+						corruptMu.Lock()
+						if len(out.Corrupt) < maxCorruptRecords {
+							out.Corrupt = append(out.Corrupt, CorruptRecord{Partition: record.Partition, Offset: record.Offset, Expected: embedded, Actual: actual})
+						}
+						corruptMu.Unlock()
+						if debug {
+							fmt.Printf("consumer debug: partition=%d offset=%d checksum %s, computed %s\n", record.Partition, record.Offset, embedded, actual)
+						}
+					}
+					if os.Getenv("KAF6_VERBOSE") == "1" && received%10 == 0 {
+						fmt.Printf("consumer: received=%d\n", received)
+					}
+					if debug {
+						fmt.Printf("consumer debug: client=%d record topic=%s partition=%d offset=%d\n", c.id, record.Topic, record.Partition, record.Offset)
+					}
+					until.observe(record.Partition, record.Offset)
+				})
+				c.mu.Lock()
+				if records == 0 {
+					c.idle += pollLatency
+				}
+				c.consumed += int64(records)
+				for partition, offset := range next {
+					c.next[partition] = max(c.next[partition], offset)
+				}
+				c.mu.Unlock()
+				if records > 0 && owned == nil {
+					commitPolled(ctx, c.client, commit, sum, debug)
+				}
+				if records > 0 {
+					lastRecord.Store(time.Now().UnixNano())
+				}
+				c.client.AllowRebalance()
+			}
+		}(c)
+	}
+	wg.Wait()
+	out.Lag = lag.finish()
+	out.StartOffsets = first.sorted()
+	switch {
+	case consumeCtx.Err() == context.DeadlineExceeded && cfg.Until == "duration":
+		until.finish("duration")
+	case consumeCtx.Err() == context.DeadlineExceeded:
+		until.finish("timeout")
+	case ctx.Err() != nil:
+		until.finish("cancelled")
+	default:
+		until.finish("idle")
+	}
+	out.EndedBy = until.endedBy
+
+	out.Clients = make([]ConsumerClientResult, len(clients))
+	for i, c := range clients {
+		out.Clients[i] = c.result()
+	}
+	out.Rebalances = rebalances.stop()
+	out.ClockSkew = skew.results()
+	closeConsumers(clients, debug)
+	consumedNext := make(map[int32]int64)
+	for _, c := range clients {
+		c.mu.Lock()
+		for partition, offset := range c.next {
+			consumedNext[partition] = max(consumedNext[partition], offset)
+		}
+		c.mu.Unlock()
+	}
+	if owned == nil && firstErr == nil {
+		out.Commits, err = verifyCommits(ctx, spec.Brokers, groupID, topic, commit, consumedNext, sum)
+		if err != nil {
+			return out, err
+		}
+	}
+	if os.Getenv("KAF6_VERBOSE") == "1" {
+		for _, resolved := range out.ResolvedOffsets {
+			fmt.Printf("consumer: resolved partition=%d offset=%d (%s)\n", resolved.Partition, resolved.Offset, out.StartMode)
+		}
+		for _, started := range out.StartOffsets {
+			fmt.Printf("consumer: first fetched partition=%d offset=%d\n", started.Partition, started.Offset)
+		}
+		for _, result := range out.Clients {
+			fmt.Printf("consumer[%d]: consumed=%d partitions=%v idle=%s\n", result.Client, result.Consumed, result.Partitions, result.Idle.Round(time.Millisecond))
+		}
+	}
+	if firstErr != nil {
+		return out, firstErr
+	}
+	if os.Getenv("KAF6_VERBOSE") == "1" {
+		fmt.Printf("consumer: ended by %s after %d records\n", out.EndedBy, total.Load())
+	}
+	if err := until.err(); err != nil {
+		return out, err
+	}
+	if cfg.Resume {
+		out.Resume, err = runResume(ctx, spec, cfg, sum, runID, out.Protocol, timeout, out.Commits)
+		if os.Getenv("KAF6_VERBOSE") == "1" && out.Resume != nil {
+			fmt.Printf("consumer resume: consumed=%d duplicates=%d skipped=%d\n", out.Resume.Consumed, out.Resume.Duplicates, out.Resume.Skipped)
+		}
+		if err != nil {
+			return out, err
+		}
+	}
+	return out, nil
+}
+
+func closeConsumers(clients []*consumerClient, debug bool) {
+	var wg sync.WaitGroup
+	for _, c := range clients {
+		if c == nil || c.client == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(client *kgo.Client) {
+			defer wg.Done()
+			closeClient(client, debug)
+		}(c.client)
+	}
+	wg.Wait()
+}
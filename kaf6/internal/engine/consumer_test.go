@@ -0,0 +1,178 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package engine
+
+import (
+	"testing"
+
+	"kaf6/internal/metrics"
+)
+
+type rebalanceStep struct {
+	client     int
+	kind       string
+	generation int32
+	partitions []int32
+}
+
+func moved(partitions ...int32) map[string][]int32 {
+	if len(partitions) == 0 {
+		return nil
+	}
+	return map[string][]int32{"topic": partitions}
+}
+
+func TestRebalanceLogCountsOnlyAfterAllClientsJoined(t *testing.T) {
+	tests := []struct {
+		name    string
+		clients int
+		steps   []rebalanceStep
+		want    int64
+	}{
+		{
+			// Five clients join one after another under an eager balancer:
+			// every join revokes everything from the clients already in.
+			name:    "eager staggered join",
+			clients: 5,
+			steps: []rebalanceStep{
+				{0, "assigned", 1, []int32{0, 1, 2, 3, 4, 5}},
+				{0, "revoked", 1, []int32{0, 1, 2, 3, 4, 5}},
+				{0, "assigned", 2, []int32{0, 1, 2}},
+				{1, "assigned", 2, []int32{3, 4, 5}},
+				{0, "revoked", 2, []int32{0, 1, 2}},
+				{1, "revoked", 2, []int32{3, 4, 5}},
+				{0, "assigned", 3, []int32{0, 1}},
+				{1, "assigned", 3, []int32{2, 3}},
+				{2, "assigned", 3, []int32{4, 5}},
+				{0, "revoked", 3, []int32{0, 1}},
+				{1, "revoked", 3, []int32{2, 3}},
+				{2, "revoked", 3, []int32{4, 5}},
+				{0, "assigned", 4, []int32{0, 1}},
+				{1, "assigned", 4, []int32{2}},
+				{2, "assigned", 4, []int32{3, 4}},
+				{3, "assigned", 4, []int32{5}},
+				{0, "revoked", 4, []int32{0, 1}},
+				{1, "revoked", 4, []int32{2}},
+				{2, "revoked", 4, []int32{3, 4}},
+				{3, "revoked", 4, []int32{5}},
+				{0, "assigned", 5, []int32{0, 1}},
+				{1, "assigned", 5, []int32{2}},
+				{2, "assigned", 5, []int32{3}},
+				{3, "assigned", 5, []int32{4}},
+				{4, "assigned", 5, []int32{5}},
+			},
+		},
+		{
+			// Under cooperative-sticky the joining client first gets an empty
+			// assignment and receives the moved partitions one generation
+			// later, after the others revoked them.
+			name:    "cooperative staggered join",
+			clients: 3,
+			steps: []rebalanceStep{
+				{0, "assigned", 1, []int32{0, 1, 2}},
+				{0, "revoked", 2, []int32{2}},
+				{1, "assigned", 2, nil},
+				{1, "assigned", 3, []int32{2}},
+				{0, "revoked", 4, []int32{1}},
+				{2, "assigned", 4, nil},
+				{2, "assigned", 5, []int32{1}},
+			},
+		},
+		{
+			name:    "more clients than partitions",
+			clients: 3,
+			steps: []rebalanceStep{
+				{0, "assigned", 1, []int32{0}},
+				{1, "assigned", 2, nil},
+				{2, "assigned", 3, nil},
+			},
+		},
+		{
+			name:    "rebalance after the group settled",
+			clients: 2,
+			steps: []rebalanceStep{
+				{0, "assigned", 1, []int32{0, 1}},
+				{0, "revoked", 2, []int32{1}},
+				{1, "assigned", 2, nil},
+				{1, "assigned", 3, []int32{1}},
+				{1, "lost", 4, []int32{1}},
+				{0, "revoked", 4, []int32{0}},
+				{0, "assigned", 5, []int32{0, 1}},
+			},
+			want: 1,
+		},
+		{
+			name:    "generation bump without moved partitions",
+			clients: 2,
+			steps: []rebalanceStep{
+				{0, "assigned", 1, []int32{0}},
+				{1, "assigned", 1, []int32{1}},
+				{0, "assigned", 2, nil},
+				{1, "assigned", 2, nil},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sum := &metrics.Summary{}
+			log := newRebalanceLog(sum, tt.clients)
+			for _, step := range tt.steps {
+				log.record(step.client, step.kind, step.generation, moved(step.partitions...))
+			}
+			if sum.Rebalances != tt.want {
+				t.Fatalf("rebalances = %d, want %d", sum.Rebalances, tt.want)
+			}
+		})
+	}
+}
+
+func TestRebalanceLogIgnoresShutdown(t *testing.T) {
+	sum := &metrics.Summary{}
+	log := newRebalanceLog(sum, 2)
+	log.record(0, "assigned", 1, moved(0))
+	log.record(1, "assigned", 1, moved(1))
+	log.stop()
+	log.record(0, "revoked", 1, moved(0))
+	log.record(1, "revoked", 1, moved(1))
+	if sum.Rebalances != 0 {
+		t.Fatalf("rebalances = %d, want 0", sum.Rebalances)
+	}
+}
+
+func TestConsumerClientResultFollowsAssignment(t *testing.T) {
+	c := &consumerClient{id: 2, assigned: make(map[int32]bool)}
+	c.assign(map[string][]int32{"topic": {3, 0, 1}})
+	c.revoke(moved(1))
+	c.assign(moved(2))
+	c.revoke(moved(5))
+	c.consumed = 7
+
+	got := c.result()
+	if got.Client != 2 || got.Consumed != 7 {
+		t.Fatalf("got client %d consumed %d, want client 2 consumed 7", got.Client, got.Consumed)
+	}
+	want := []int32{0, 2, 3}
+	if len(got.Partitions) != len(want) {
+		t.Fatalf("got partitions %v, want %v", got.Partitions, want)
+	}
+	for i := range want {
+		if got.Partitions[i] != want[i] {
+			t.Fatalf("got partitions %v, want %v", got.Partitions, want)
+		}
+	}
+}
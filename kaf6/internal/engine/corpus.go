@@ -0,0 +1,305 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"kaf6/internal/scenario"
+)
+
+// maxCorpusRecordSize bounds a single JSONL line or binary frame so a
+// corrupt length prefix cannot make the loader allocate gigabytes.
+const maxCorpusRecordSize = 64 * 1024 * 1024
+
+type corpusRecord struct {
+	Key       []byte
+	Value     []byte
+	Headers   []kgo.RecordHeader
+	Timestamp time.Time
+}
+
+// corpusEntry locates one record in the corpus file. gap is the time since
+// the previous record's timestamp in file order.
+type corpusEntry struct {
+	offset int64
+	size   int
+	gap    time.Duration
+}
+
+// corpus replays captured records. The file is indexed once and records are
+// read back on demand, so memory grows with the record count rather than the
+// file size. All producer clients share one cursor so a sequential replay
+// keeps the file order, and one schedule so preserved inter-arrival gaps
+// apply to the combined stream.
+type corpus struct {
+	file     *os.File
+	format   string
+	entries  []corpusEntry
+	sample   bool
+	preserve bool
+
+	mu     sync.Mutex
+	cursor int
+	offset time.Duration
+	start  time.Time
+}
+
+type corpusLine struct {
+	Key         *string         `json:"key"`
+	KeyBase64   string          `json:"key_base64"`
+	Value       json.RawMessage `json:"value"`
+	ValueBase64 string          `json:"value_base64"`
+	Headers     map[string]any  `json:"headers"`
+	Timestamp   json.RawMessage `json:"timestamp"`
+}
+
+func loadCorpus(path string, spec scenario.PayloadSpec) (*corpus, error) {
+	format := spec.Format
+	if format == "" {
+		format = "jsonl"
+		if strings.HasSuffix(path, ".bin") {
+			format = "binary"
+		}
+	}
+	switch format {
+	case "jsonl":
+	case "binary":
+		if spec.PreserveTiming || spec.OriginalTimestamps {
+			return nil, fmt.Errorf("binary corpus %s holds values only; preserve_timing and original_timestamps need a jsonl corpus", path)
+		}
+	default:
+		return nil, fmt.Errorf("unknown corpus format: %s", format)
+	}
+	switch spec.Order {
+	case "", "sequential", "sample":
+	default:
+		return nil, fmt.Errorf("unknown corpus order: %s", spec.Order)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	var entries []corpusEntry
+	if format == "binary" {
+		entries, err = indexBinaryCorpus(file)
+	} else {
+		entries, err = indexJSONLCorpus(file)
+	}
+	if err == nil && len(entries) == 0 {
+		err = fmt.Errorf("corpus is empty")
+	}
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("read corpus %s: %w", path, err)
+	}
+	return &corpus{
+		file:     file,
+		format:   format,
+		entries:  entries,
+		sample:   spec.Order == "sample",
+		preserve: spec.PreserveTiming,
+	}, nil
+}
+
+// indexJSONLCorpus parses every line once to reject a bad corpus up front
+// and records where each non-empty line starts.
+func indexJSONLCorpus(r io.Reader) ([]corpusEntry, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxCorpusRecordSize)
+	scanner.Split(scanFullLines)
+	var out []corpusEntry
+	var offset int64
+	var prev time.Time
+	line := 0
+	for scanner.Scan() {
+		line++
+		raw := scanner.Bytes()
+		start := offset
+		offset += int64(len(raw))
+		if len(bytes.TrimSpace(raw)) == 0 {
+			continue
+		}
+		record, err := parseCorpusLine(raw)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		entry := corpusEntry{offset: start, size: len(raw)}
+		if !prev.IsZero() && record.Timestamp.After(prev) {
+			entry.gap = record.Timestamp.Sub(prev)
+		}
+		prev = record.Timestamp
+		out = append(out, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return nil, fmt.Errorf("line %d: longer than %d bytes", line+1, maxCorpusRecordSize)
+		}
+		return nil, err
+	}
+	return out, nil
+}
+
+// scanFullLines splits like bufio.ScanLines but keeps the line terminator,
+// so token lengths add up to file offsets.
+func scanFullLines(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return i + 1, data[:i+1], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+func parseCorpusLine(raw []byte) (corpusRecord, error) {
+	var entry corpusLine
+	if err := json.Unmarshal(raw, &entry); err != nil {
+		return corpusRecord{}, err
+	}
+	return entry.record()
+}
+
+func (l corpusLine) record() (corpusRecord, error) {
+	var record corpusRecord
+	var err error
+	switch {
+	case l.KeyBase64 != "":
+		if record.Key, err = base64.StdEncoding.DecodeString(l.KeyBase64); err != nil {
+			return record, fmt.Errorf("key_base64: %w", err)
+		}
+	case l.Key != nil:
+		record.Key = []byte(*l.Key)
+	}
+	switch {
+	case l.ValueBase64 != "":
+		if record.Value, err = base64.StdEncoding.DecodeString(l.ValueBase64); err != nil {
+			return record, fmt.Errorf("value_base64: %w", err)
+		}
+	case len(l.Value) > 0 && l.Value[0] == '"':
+		var text string
+		if err := json.Unmarshal(l.Value, &text); err != nil {
+			return record, err
+		}
+		record.Value = []byte(text)
+	case len(l.Value) > 0 && string(l.Value) != "null":
+		record.Value = []byte(l.Value)
+	}
+	headers, err := parseHeaders(l.Headers)
+	if err != nil {
+		return record, err
+	}
+	for _, header := range headers {
+		record.Headers = append(record.Headers, kgo.RecordHeader{Key: header.Key, Value: header.literal()})
+	}
+	if len(l.Timestamp) > 0 && string(l.Timestamp) != "null" {
+		var millis int64
+		var text string
+		switch {
+		case json.Unmarshal(l.Timestamp, &millis) == nil:
+			record.Timestamp = time.UnixMilli(millis)
+		case json.Unmarshal(l.Timestamp, &text) == nil:
+			if record.Timestamp, err = time.Parse(time.RFC3339Nano, text); err != nil {
+				return record, fmt.Errorf("timestamp: %w", err)
+			}
+		default:
+			return record, fmt.Errorf("timestamp must be epoch millis or RFC3339")
+		}
+	}
+	return record, nil
+}
+
+// indexBinaryCorpus indexes values framed as a 4-byte big-endian length
+// followed by the value bytes. The format carries no keys, headers or
+// timestamps.
+func indexBinaryCorpus(r io.Reader) ([]corpusEntry, error) {
+	reader := bufio.NewReader(r)
+	var out []corpusEntry
+	var offset int64
+	var size [4]byte
+	for {
+		if _, err := io.ReadFull(reader, size[:]); err != nil {
+			if err == io.EOF {
+				return out, nil
+			}
+			return nil, fmt.Errorf("record %d: %w", len(out), err)
+		}
+		length := binary.BigEndian.Uint32(size[:])
+		if length > maxCorpusRecordSize {
+			return nil, fmt.Errorf("record %d: length %d exceeds %d bytes", len(out), length, maxCorpusRecordSize)
+		}
+		if _, err := reader.Discard(int(length)); err != nil {
+			return nil, fmt.Errorf("record %d: %w", len(out), io.ErrUnexpectedEOF)
+		}
+		out = append(out, corpusEntry{offset: offset + 4, size: int(length)})
+		offset += 4 + int64(length)
+	}
+}
+
+// next returns the next record and, when timing is preserved, the wall-clock
+// time it should be sent at.
+func (c *corpus) next(rng *rand.Rand) (corpusRecord, time.Time, error) {
+	c.mu.Lock()
+	idx := c.cursor % len(c.entries)
+	if c.sample {
+		idx = rng.Intn(len(c.entries))
+	}
+	c.cursor++
+	entry := c.entries[idx]
+	var sendAt time.Time
+	if c.preserve {
+		if c.start.IsZero() {
+			c.start = time.Now()
+		} else {
+			c.offset += entry.gap
+		}
+		sendAt = c.start.Add(c.offset)
+	}
+	c.mu.Unlock()
+
+	raw := make([]byte, entry.size)
+	if _, err := c.file.ReadAt(raw, entry.offset); err != nil {
+		return corpusRecord{}, time.Time{}, fmt.Errorf("read corpus record %d: %w", idx, err)
+	}
+	if c.format == "binary" {
+		return corpusRecord{Value: raw}, sendAt, nil
+	}
+	record, err := parseCorpusLine(raw)
+	if err != nil {
+		return corpusRecord{}, time.Time{}, fmt.Errorf("read corpus record %d: %w", idx, err)
+	}
+	return record, sendAt, nil
+}
+
+func (c *corpus) close() error {
+	return c.file.Close()
+}
@@ -0,0 +1,134 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package engine
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"kaf6/internal/scenario"
+)
+
+func TestCorpusReplaysRecordsFromFile(t *testing.T) {
+	dir := t.TempDir()
+	jsonl := filepath.Join(dir, "records.jsonl")
+	lines := `{"key":"a","value":{"n":1},"headers":{"h":"1"},"timestamp":1000}` + "\n" +
+		"\n" +
+		`{"key":"b","value":"two","timestamp":1250}` + "\r\n" +
+		`{"key_base64":"Yw==","value_base64":"dGhyZWU=","timestamp":1300}`
+	if err := os.WriteFile(jsonl, []byte(lines), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var frames []byte
+	for _, value := range []string{"one", "", "three"} {
+		frames = binary.BigEndian.AppendUint32(frames, uint32(len(value)))
+		frames = append(frames, value...)
+	}
+	bin := filepath.Join(dir, "records.bin")
+	if err := os.WriteFile(bin, frames, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		path   string
+		keys   []string
+		values []string
+		gaps   []time.Duration
+	}{
+		{
+			name:   "jsonl",
+			path:   jsonl,
+			keys:   []string{"a", "b", "c", "a"},
+			values: []string{`{"n":1}`, "two", "three", `{"n":1}`},
+			gaps:   []time.Duration{0, 250 * time.Millisecond, 50 * time.Millisecond},
+		},
+		{
+			name:   "binary",
+			path:   bin,
+			keys:   []string{"", "", "", ""},
+			values: []string{"one", "", "three", "one"},
+			gaps:   []time.Duration{0, 0, 0},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := loadCorpus(tc.path, scenario.PayloadSpec{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.close()
+			if len(c.entries) != len(tc.gaps) {
+				t.Fatalf("entries = %d, want %d", len(c.entries), len(tc.gaps))
+			}
+			for i, gap := range tc.gaps {
+				if c.entries[i].gap != gap {
+					t.Errorf("entry %d gap = %v, want %v", i, c.entries[i].gap, gap)
+				}
+			}
+			rng := rand.New(rand.NewSource(1))
+			for i := range tc.values {
+				record, _, err := c.next(rng)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(record.Key) != tc.keys[i] || string(record.Value) != tc.values[i] {
+					t.Errorf("record %d = %q/%q, want %q/%q", i, record.Key, record.Value, tc.keys[i], tc.values[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLoadCorpusRejects(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	valid := write("valid.bin", []byte{0, 0, 0, 1, 'x'})
+	cases := []struct {
+		name string
+		path string
+		spec scenario.PayloadSpec
+		want string
+	}{
+		{name: "binary preserve timing", path: valid, spec: scenario.PayloadSpec{PreserveTiming: true}, want: "holds values only"},
+		{name: "binary original timestamps", path: valid, spec: scenario.PayloadSpec{OriginalTimestamps: true}, want: "holds values only"},
+		{name: "oversized frame", path: write("huge.bin", []byte{0xff, 0xff, 0xff, 0xff}), want: "exceeds"},
+		{name: "truncated frame", path: write("short.bin", []byte{0, 0, 0, 9, 'x'}), want: "unexpected EOF"},
+		{name: "bad line", path: write("bad.jsonl", []byte("{\"value\":1}\nnot json\n")), want: "line 2"},
+		{name: "empty", path: write("empty.jsonl", []byte("\n\n")), want: "empty"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := loadCorpus(tc.path, tc.spec)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("error = %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
@@ -19,19 +19,20 @@ package engine
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/twmb/franz-go/pkg/kadm"
 	"github.com/twmb/franz-go/pkg/kgo"
 
 	"kaf6/internal/metrics"
+	"kaf6/internal/registry"
 	"kaf6/internal/scenario"
 )
 
@@ -51,24 +52,170 @@ type Result struct {
 	Produced           int64
 	Consumed           int64
 	Errors             int64
+	HeaderMismatches   int64
+	SchemaErrors       int64
+	Rebalances         int64
+	CommitMismatches   int64
+	Duplicates         int64
+	ConfigMismatches   int64
+	AdminFailures      int64
+	GroupFailures      int64
+	Corrupted          int64
+	ClockSkew          int64
 	ProduceP           metrics.Percentiles
+	ProduceCorrectedP  metrics.Percentiles
+	ProduceHistogram   []metrics.HistogramBucket
+	CorrectedHistogram []metrics.HistogramBucket
 	ConsumeP           metrics.Percentiles
 	ConsumePollP       metrics.Percentiles
+	EndToEndP          metrics.Percentiles
+	BrokerDeltaP       metrics.Percentiles
+	Topics             []TopicResult
+	Producer           *ProducerResult
+	Consumer           *ConsumerResult
+	Search             *SearchResult
+	Compression        []CodecResult
+	Durability         *DurabilityResult
+	Manifest           *Manifest `json:"-"`
+	Admin              []AdminStepResult
+	Groups             []GroupStepResult
+	Cleanup            *CleanupResult
 	Checks             map[string]string
 	Duration           time.Duration
 	StartedAt          time.Time
 	Status             string
 }
 
+const (
+	// minRunDeadline is the shortest deadline a run gets when the scenario
+	// sets no timeout.
+	minRunDeadline = 2 * time.Minute
+	// runDeadlineMargin covers topic setup, admin and group steps and the
+	// unbounded parts of each step on top of the step timeouts.
+	runDeadlineMargin = 1 * time.Minute
+)
+
+// runDeadline bounds the whole run. An explicit scenario timeout wins, but
+// must leave room for a paced producer's schedule; otherwise the budget adds
+// up the paced schedule, the consumer, compression and verify timeouts and
+// the search probes plus a margin, and is at least minRunDeadline.
+func runDeadline(spec *scenario.ScenarioFile) (time.Duration, error) {
+	var schedule time.Duration
+	if cfg := spec.Scenarios.Producer; cfg != nil {
+		schedule = pacedSchedule(cfg.Messages, cfg.Clients, cfg.RatePerS)
+	}
+	if spec.Timeout != "" {
+		timeout, err := time.ParseDuration(spec.Timeout)
+		if err != nil || timeout <= 0 {
+			return 0, fmt.Errorf("invalid scenario timeout: %s", spec.Timeout)
+		}
+		if schedule > timeout {
+			return 0, fmt.Errorf("paced producer schedule takes %s, longer than the scenario timeout %s", schedule, timeout)
+		}
+		return timeout, nil
+	}
+	budget := runDeadlineMargin + schedule
+	if cfg := spec.Scenarios.Consumer; cfg != nil {
+		timeout := durationOr(cfg.Timeout, 30*time.Second)
+		if cfg.Until == "duration" {
+			timeout = durationOr(cfg.Duration, timeout)
+		}
+		if cfg.Resume {
+			timeout *= 2
+		}
+		budget += timeout
+	}
+	if cfg := spec.Scenarios.Compression; cfg != nil {
+		budget += durationOr(cfg.Timeout, 30*time.Second)
+	}
+	if cfg := spec.Scenarios.Search; cfg != nil {
+		budget += searchBudget(cfg)
+	}
+	if spec.Phase == "verify" {
+		timeout := spec.VerifyTimeout
+		if timeout <= 0 {
+			timeout = defaultVerifyTimeout
+		}
+		budget += timeout
+	}
+	return max(budget, minRunDeadline), nil
+}
+
+// pacedSchedule is how long a producer paced at rate takes to send messages
+// records over clients, or 0 when it is not paced.
+func pacedSchedule(messages int, clients int, rate float64) time.Duration {
+	if rate <= 0 {
+		return 0
+	}
+	clients = max(clients, 1)
+	perClient := max(messages/clients, 1)
+	return time.Duration(perClient) * pacedInterval(clients, rate)
+}
+
+// pacedInterval is the gap between two sends of one producer client.
+func pacedInterval(clients int, rate float64) time.Duration {
+	return time.Duration(float64(time.Second) * float64(clients) / rate)
+}
+
+// durationOr parses value, falling back when it is empty or invalid the same
+// way the steps do.
+func durationOr(value string, fallback time.Duration) time.Duration {
+	if parsed, err := time.ParseDuration(value); err == nil && parsed > 0 {
+		return parsed
+	}
+	return fallback
+}
+
 func Run(ctx context.Context, spec *scenario.ScenarioFile) (*Result, error) {
 	start := time.Now()
 	runID := start.Format("20060102-150405")
 	sum := &metrics.Summary{}
 	var runErr error
-	runCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+
+	// Two-phase runs split one scenario across processes: the produce phase
+	// only sets up topics and produces, the verify phase only reconciles the
+	// topic against the manifest. Scenario checks apply to neither.
+	var manifest *Manifest
+	switch spec.Phase {
+	case "":
+	case "produce":
+		if spec.Scenarios.Producer == nil {
+			return nil, fmt.Errorf("phase produce needs a producer scenario")
+		}
+		spec.Scenarios = scenario.ScenarioCollection{Producer: spec.Scenarios.Producer}
+		spec.Checks = nil
+	case "verify":
+		var err error
+		manifest, err = ReadManifest(spec.Manifest)
+		if err != nil {
+			return nil, err
+		}
+		spec.Scenarios = scenario.ScenarioCollection{}
+		spec.Checks = nil
+	default:
+		return nil, fmt.Errorf("unknown phase: %s", spec.Phase)
+	}
+	deadline, err := runDeadline(spec)
+	if err != nil {
+		return nil, err
+	}
+	runCtx, cancel := context.WithTimeout(ctx, deadline)
 	defer cancel()
-	connectivityStatus := "ok"
-	var connectivityErr error
+	// The result is filled in as the steps run and finished on whichever
+	// path the run leaves by.
+	result := &Result{
+		Name:               spec.Name,
+		Description:        spec.Description,
+		RunID:              runID,
+		Profile:            spec.Profile,
+		ProfileName:        spec.ProfileName,
+		ProfileDescription: spec.ProfileDescription,
+		ProfileSource:      spec.ProfileSource,
+		ProfileMetricsURL:  spec.ProfileMetricsURL,
+		ConnectivityStatus: "ok",
+		Brokers:            spec.Brokers,
+		StartedAt:          start,
+	}
 
 	verbose := os.Getenv("KAF6_VERBOSE") == "1"
 	if verbose {
@@ -77,78 +224,77 @@ func Run(ctx context.Context, spec *scenario.ScenarioFile) (*Result, error) {
 		fmt.Printf("profile: %s\n", spec.Profile)
 	}
 	if err := checkConnectivity(spec.Brokers, 2*time.Second); err != nil {
-		connectivityStatus = "fail"
-		connectivityErr = err
+		result.ConnectivityStatus = "fail"
+		result.ConnectivityError = err.Error()
 		sum.AddError()
 		runErr = fmt.Errorf("connectivity check failed: %w", err)
+		result.finish(spec, sum, runErr)
+		return result, runErr
 	}
-	if runErr != nil {
-		result := &Result{
-			Name:               spec.Name,
-			Description:        spec.Description,
-			RunID:              runID,
-			Profile:            spec.Profile,
-			ProfileName:        spec.ProfileName,
-			ProfileDescription: spec.ProfileDescription,
-			ProfileSource:      spec.ProfileSource,
-			ProfileMetricsURL:  spec.ProfileMetricsURL,
-			ConnectivityStatus: connectivityStatus,
-			ConnectivityError:  errorText(connectivityErr),
-			RunError:           errorText(runErr),
-			Brokers:            spec.Brokers,
-			Produced:           sum.Produced,
-			Consumed:           sum.Consumed,
-			Errors:             sum.Errors,
-			ProduceP:           metrics.LatencyPercentiles(sum.ProduceLatencies),
-			ConsumeP:           metrics.LatencyPercentiles(sum.ConsumeLatencies),
-			ConsumePollP:       metrics.LatencyPercentiles(sum.ConsumePollLatencies),
-			Checks:             evaluateChecks(spec, sum),
-			Duration:           time.Since(start),
-			StartedAt:          start,
-			Status:             "fail",
+	if usesEmbeddedRegistry(spec) {
+		srv, err := registry.Start()
+		if err != nil {
+			sum.AddError()
+			runErr = fmt.Errorf("start schema registry: %w", err)
+		} else {
+			defer srv.Close()
+			setEmbeddedRegistry(spec, srv.URL())
+			if verbose {
+				fmt.Printf("schema registry: %s\n", srv.URL())
+			}
 		}
-		return result, runErr
 	}
-	if spec.Scenarios.Producer != nil {
-		if err := ensureTopics(runCtx, spec, runID, verbose); err != nil {
+	var topics []TopicResult
+	if runErr == nil && (spec.Scenarios.Producer != nil || spec.Scenarios.Compression != nil || spec.Scenarios.Admin != nil || spec.Scenarios.Search != nil) {
+		var err error
+		topics, err = ensureTopics(runCtx, spec, sum, runID, verbose)
+		if err != nil {
 			sum.AddError()
 			runErr = err
 		}
 		if runErr != nil {
-			result := &Result{
-				RunID:              runID,
-				Profile:            spec.Profile,
-				ProfileName:        spec.ProfileName,
-				ProfileDescription: spec.ProfileDescription,
-				ProfileSource:      spec.ProfileSource,
-				ProfileMetricsURL:  spec.ProfileMetricsURL,
-				ConnectivityStatus: connectivityStatus,
-				ConnectivityError:  errorText(connectivityErr),
-				RunError:           errorText(runErr),
-				Brokers:            spec.Brokers,
-				Produced:           sum.Produced,
-				Consumed:           sum.Consumed,
-				Errors:             sum.Errors,
-				ProduceP:           metrics.LatencyPercentiles(sum.ProduceLatencies),
-				ConsumeP:           metrics.LatencyPercentiles(sum.ConsumeLatencies),
-				Checks:             evaluateChecks(spec, sum),
-				Duration:           time.Since(start),
-				StartedAt:          start,
-			}
+			result.Topics = topics
+			result.finish(spec, sum, runErr)
+			result.Cleanup = teardown(ctx, spec, runTopics(spec, runID, topics), runGroups(spec, runID), result.Status, verbose)
 			if verbose {
 				fmt.Printf("result: produced=%d consumed=%d errors=%d\n", result.Produced, result.Consumed, result.Errors)
 			}
 			return result, runErr
 		}
+	}
+	produced := &produceLog{start: time.Now(), manifest: spec.Phase == "produce"}
+	// Lag sampling starts with the producer so the series shows the backlog
+	// building up, not only the consumer working it off.
+	var lag *lagSampler
+	if spec.Scenarios.Producer != nil && spec.Scenarios.Consumer != nil {
+		topicName := resolveTopic(spec.Scenarios.Consumer.Topic, spec.Topics, runID)
+		lag = startLag(runCtx, spec.Brokers, topicName, lagInterval(spec.Scenarios.Consumer), produced, sum)
+	}
+	var producer *ProducerResult
+	if spec.Scenarios.Producer != nil {
 		if verbose {
 			topicName := resolveTopic(spec.Scenarios.Producer.Topic, spec.Topics, runID)
 			fmt.Printf("scenario: producer (clients=%d messages=%d topic=%s)\n", spec.Scenarios.Producer.Clients, spec.Scenarios.Producer.Messages, topicName)
 		}
-		if err := runProducer(runCtx, spec, sum, runID); err != nil {
+		results, err := runProducer(runCtx, spec, sum, runID, produced)
+		producer = results
+		if err != nil {
+			sum.AddError()
+			runErr = err
+		}
+	}
+	produced.finish()
+	if runErr == nil && spec.Scenarios.Producer != nil && spec.Scenarios.Consumer != nil && spec.Scenarios.Consumer.Until == "hwm" {
+		topicName := resolveTopic(spec.Scenarios.Consumer.Topic, spec.Topics, runID)
+		ends, err := listEndOffsets(runCtx, spec.Brokers, topicName)
+		if err != nil {
 			sum.AddError()
 			runErr = err
+		} else {
+			produced.setEnds(topicName, ends)
 		}
 	}
+	var consumer *ConsumerResult
 	if runErr == nil && spec.Scenarios.Consumer != nil {
 		time.Sleep(2 * time.Second)
 		groupID := resolvedGroupID(spec.Scenarios.Consumer.Group.ID, runID)
@@ -156,7 +302,48 @@ func Run(ctx context.Context, spec *scenario.ScenarioFile) (*Result, error) {
 		if verbose {
 			fmt.Printf("scenario: consumer (clients=%d group=%s topic=%s limit=%d)\n", spec.Scenarios.Consumer.Clients, groupID, topicName, spec.Scenarios.Consumer.Limit)
 		}
-		if err := runConsumer(runCtx, spec, sum, runID); err != nil {
+		results, err := runConsumer(runCtx, spec, sum, runID, produced, lag)
+		consumer = results
+		if err != nil {
+			sum.AddError()
+			runErr = err
+		}
+	}
+	if lag != nil {
+		lag.finish()
+	}
+	var search *SearchResult
+	if runErr == nil && spec.Scenarios.Search != nil {
+		if verbose {
+			fmt.Printf("scenario: search (rate %.1f-%.1f records/s)\n", spec.Scenarios.Search.MinRate, spec.Scenarios.Search.MaxRate)
+		}
+		results, err := runSearch(runCtx, spec, sum, runID, verbose)
+		search = results
+		if err != nil {
+			sum.AddError()
+			runErr = err
+		}
+	}
+	var admin []AdminStepResult
+	if runErr == nil && spec.Scenarios.Admin != nil {
+		if verbose {
+			fmt.Printf("scenario: admin (steps=%d)\n", len(spec.Scenarios.Admin.Steps))
+		}
+		results, err := runAdmin(runCtx, spec, sum, runID, verbose)
+		admin = results
+		if err != nil {
+			sum.AddError()
+			runErr = err
+		}
+	}
+	var groups []GroupStepResult
+	if runErr == nil && spec.Scenarios.Groups != nil {
+		if verbose {
+			fmt.Printf("scenario: groups (steps=%d)\n", len(spec.Scenarios.Groups.Steps))
+		}
+		results, err := runGroupSteps(runCtx, spec, sum, runID, verbose)
+		groups = results
+		if err != nil {
 			sum.AddError()
 			runErr = err
 		}
@@ -170,94 +357,247 @@ func Run(ctx context.Context, spec *scenario.ScenarioFile) (*Result, error) {
 			runErr = err
 		}
 	}
+	var compression []CodecResult
+	if runErr == nil && spec.Scenarios.Compression != nil {
+		if verbose {
+			topicName := resolveTopic(spec.Scenarios.Compression.Topic, spec.Topics, runID)
+			fmt.Printf("scenario: compression (codecs=%v messages=%d topic=%s)\n", spec.Scenarios.Compression.Codecs, spec.Scenarios.Compression.Messages, topicName)
+		}
+		results, err := runCompressionMatrix(runCtx, spec, sum, runID)
+		compression = results
+		if err != nil {
+			sum.AddError()
+			runErr = err
+		}
+	}
 
-	checks := evaluateChecks(spec, sum)
-
-	result := &Result{
-		Name:               spec.Name,
-		Description:        spec.Description,
-		RunID:              runID,
-		Profile:            spec.Profile,
-		ProfileName:        spec.ProfileName,
-		ProfileDescription: spec.ProfileDescription,
-		ProfileSource:      spec.ProfileSource,
-		ProfileMetricsURL:  spec.ProfileMetricsURL,
-		ConnectivityStatus: connectivityStatus,
-		ConnectivityError:  errorText(connectivityErr),
-		RunError:           errorText(runErr),
-		Brokers:            spec.Brokers,
-		Produced:           sum.Produced,
-		Consumed:           sum.Consumed,
-		Errors:             sum.Errors,
-		ProduceP:           metrics.LatencyPercentiles(sum.ProduceLatencies),
-		ConsumeP:           metrics.LatencyPercentiles(sum.ConsumeLatencies),
-		ConsumePollP:       metrics.LatencyPercentiles(sum.ConsumePollLatencies),
-		Checks:             checks,
-		Duration:           time.Since(start),
-		StartedAt:          start,
+	var durability *DurabilityResult
+	if runErr == nil && manifest != nil {
+		if verbose {
+			fmt.Printf("phase: verify (manifest=%s topic=%s records=%d)\n", spec.Manifest, manifest.Topic, len(manifest.Records))
+		}
+		results, err := verifyManifest(runCtx, spec, manifest, spec.Manifest, verbose)
+		durability = results
+		if err != nil {
+			sum.AddError()
+			runErr = err
+		}
 	}
-	result.Status = "pass"
-	if runErr != nil {
-		result.Status = "fail"
-	} else {
-		for _, status := range checks {
-			if status != "pass" {
-				result.Status = "fail"
-				break
-			}
+
+	result.Topics = topics
+	result.Producer = producer
+	result.Consumer = consumer
+	result.Search = search
+	result.Compression = compression
+	result.Durability = durability
+	result.Admin = admin
+	result.Groups = groups
+	result.finish(spec, sum, runErr)
+	if spec.Phase == "produce" {
+		result.Manifest = &Manifest{
+			RunID:      runID,
+			Scenario:   spec.Name,
+			Topic:      resolveTopic(spec.Scenarios.Producer.Topic, spec.Topics, runID),
+			Brokers:    spec.Brokers,
+			ProducedAt: produced.start,
+			Records:    produced.sortedRecords(),
 		}
 	}
-	if result.Status == "pass" && sum.Errors > 0 {
-		result.Status = "fail"
+	cleanupTopics, cleanupGroups := runTopics(spec, runID, topics), runGroups(spec, runID)
+	if search != nil {
+		cleanupGroups = append(cleanupGroups, search.Groups...)
 	}
-	if result.Status == "pass" && connectivityStatus != "ok" {
-		result.Status = "fail"
+	if manifest != nil {
+		cleanupTopics, cleanupGroups = []string{manifest.Topic}, nil
 	}
+	result.Cleanup = teardown(ctx, spec, cleanupTopics, cleanupGroups, result.Status, verbose)
 	if verbose {
 		fmt.Printf("result: produced=%d consumed=%d errors=%d\n", result.Produced, result.Consumed, result.Errors)
 	}
 	return result, runErr
 }
 
-func runProducer(ctx context.Context, spec *scenario.ScenarioFile, sum *metrics.Summary, runID string) error {
+// finish copies the counters and latencies from sum, evaluates the checks and
+// sets the status. The run fails on a run error, a failed check, any counted
+// error or mismatch, or a failed search or durability verdict.
+func (r *Result) finish(spec *scenario.ScenarioFile, sum *metrics.Summary, runErr error) {
+	r.RunError = errorText(runErr)
+	r.Produced = sum.Produced
+	r.Consumed = sum.Consumed
+	r.Errors = sum.Errors
+	r.HeaderMismatches = sum.HeaderMismatches
+	r.SchemaErrors = sum.SchemaErrors
+	r.Rebalances = sum.Rebalances
+	r.CommitMismatches = sum.CommitMismatches
+	r.Duplicates = sum.Duplicates
+	r.ConfigMismatches = sum.ConfigMismatches
+	r.AdminFailures = sum.AdminFailures
+	r.GroupFailures = sum.GroupFailures
+	r.Corrupted = sum.Corrupted
+	r.ClockSkew = sum.ClockSkew
+	r.ProduceP = metrics.LatencyPercentiles(sum.ProduceLatencies)
+	r.ProduceCorrectedP = metrics.LatencyPercentiles(sum.ProduceCorrected)
+	r.ProduceHistogram = metrics.LatencyHistogram(sum.ProduceLatencies)
+	r.CorrectedHistogram = metrics.LatencyHistogram(sum.ProduceCorrected)
+	r.ConsumeP = metrics.LatencyPercentiles(sum.ConsumeLatencies)
+	r.EndToEndP = metrics.LatencyPercentiles(sum.EndToEndLatencies)
+	r.BrokerDeltaP = metrics.LatencyPercentiles(sum.BrokerDeltas)
+	r.ConsumePollP = metrics.LatencyPercentiles(sum.ConsumePollLatencies)
+	r.Checks = evaluateChecks(spec, sum)
+	r.Duration = time.Since(r.StartedAt)
+
+	r.Status = "fail"
+	switch {
+	case runErr != nil, r.ConnectivityStatus != "ok":
+	case sum.Errors > 0, sum.HeaderMismatches > 0, sum.SchemaErrors > 0, sum.Corrupted > 0:
+	case sum.CommitMismatches > 0, sum.Duplicates > 0, sum.AdminFailures > 0, sum.GroupFailures > 0:
+	case r.Search != nil && r.Search.Status != "pass":
+	case r.Durability != nil && r.Durability.Status != "pass":
+	default:
+		r.Status = "pass"
+		for _, status := range r.Checks {
+			if status != "pass" {
+				r.Status = "fail"
+				break
+			}
+		}
+	}
+}
+
+func runProducer(ctx context.Context, spec *scenario.ScenarioFile, sum *metrics.Summary, runID string, produced *produceLog) (*ProducerResult, error) {
 	cfg := spec.Scenarios.Producer
 	if cfg.Clients <= 0 {
 		cfg.Clients = 1
 	}
+	topic := resolveTopic(cfg.Topic, spec.Topics, runID)
+	if topic == "" {
+		return nil, fmt.Errorf("producer topic is required")
+	}
+	result := &ProducerResult{Mode: cfg.Mode}
+	switch cfg.Mode {
+	case "", "sync":
+		result.Mode = "sync"
+	case "async":
+		result.InFlight = cfg.InFlight
+		if result.InFlight <= 0 {
+			result.InFlight = defaultInFlight
+		}
+	default:
+		return nil, fmt.Errorf("unknown producer mode: %s", cfg.Mode)
+	}
+	if cfg.Linger != "" {
+		linger, err := time.ParseDuration(cfg.Linger)
+		if err != nil {
+			return nil, fmt.Errorf("producer linger: %w", err)
+		}
+		result.Linger = linger
+	}
+
+	payload, err := newProducerPayload(ctx, spec, cfg.Value, topic, runID)
+	if err != nil {
+		return nil, fmt.Errorf("producer payload: %w", err)
+	}
+	defer payload.close()
+	if cfg.Messages <= 0 {
+		cfg.Messages = payload.corpusSize()
+	}
 	if cfg.Messages <= 0 {
 		cfg.Messages = 1
 	}
-	topic := resolveTopic(cfg.Topic, spec.Topics, runID)
-	if topic == "" {
-		return fmt.Errorf("producer topic is required")
+	codec, err := compressionCodec(cfg.Compression)
+	if err != nil {
+		return nil, err
+	}
+	switch cfg.Checksum {
+	case "", "none", "header", "field":
+	default:
+		return nil, fmt.Errorf("unknown checksum mode: %s", cfg.Checksum)
 	}
 
+	recorder := &produceRecorder{}
 	options := []kgo.Opt{
 		kgo.SeedBrokers(spec.Brokers...),
 		kgo.DisableIdempotentWrite(),
 		kgo.AllowAutoTopicCreation(),
+		kgo.ProducerBatchCompression(codec),
+		kgo.WithHooks(recorder),
+	}
+	if result.Linger > 0 {
+		options = append(options, kgo.ProducerLinger(result.Linger))
+	}
+	if payload.maxSize > 900*1024 {
+		options = append(options, kgo.ProducerBatchMaxBytes(int32(payload.maxSize+64*1024)))
 	}
 	if os.Getenv("KAF6_DEBUG") != "0" {
 		options = append(options, kgo.WithLogger(newDebugLogger("producer")))
 	}
 	client, err := kgo.NewClient(options...)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer client.Close()
 
-	payloadTemplate := cfg.Value.JSON
+	headers, err := parseHeaders(cfg.Headers)
+	if err != nil {
+		return nil, fmt.Errorf("producer headers: %w", err)
+	}
 	total := cfg.Messages
 	perClient := total / cfg.Clients
 	if perClient == 0 {
 		perClient = 1
 	}
+	// With a rate, every client sends on a fixed schedule, staggered so that
+	// the clients together reach rate_per_s. A client that falls behind sends
+	// the next record at once rather than shifting the schedule, and latency
+	// is also measured from the scheduled time.
+	var interval time.Duration
+	if cfg.RatePerS > 0 {
+		interval = pacedInterval(cfg.Clients, cfg.RatePerS)
+		// A schedule the deadline would cut short reports nothing useful,
+		// so fail before sending. This also covers corpus-sized runs the
+		// run deadline could not account for up front.
+		schedule := time.Duration(perClient) * interval
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < schedule {
+			return nil, fmt.Errorf("paced producer schedule of %d records at %.1f/s takes %s, past the run deadline in %s; raise the scenario timeout", perClient*cfg.Clients, cfg.RatePerS, schedule, time.Until(deadline).Round(time.Second))
+		}
+	}
+	scheduleStart := time.Now()
+
+	// Async mode hands records to the client without waiting, so the client
+	// can batch and linger; window bounds the records not yet acknowledged
+	// across all producer clients.
+	var window chan struct{}
+	if result.Mode == "async" {
+		window = make(chan struct{}, result.InFlight)
+	}
+	verbose := os.Getenv("KAF6_VERBOSE") == "1"
+	var acked atomic.Int64
+	finish := func(clientID int, record *kgo.Record, start time.Time, sendAt time.Time, err error) {
+		if err != nil {
+			sum.AddError()
+			if verbose {
+				fmt.Printf("producer[%d]: error: %v\n", clientID, err)
+			}
+			return
+		}
+		ackedAt := time.Now()
+		sum.AddProduce(ackedAt.Sub(start))
+		if !sendAt.IsZero() {
+			sum.AddProduceCorrected(ackedAt.Sub(sendAt))
+		}
+		produced.add(record)
+		if n := acked.Add(1); verbose && n%10 == 0 {
+			fmt.Printf("producer: sent=%d\n", n)
+		}
+	}
 
 	var wg sync.WaitGroup
 	wg.Add(cfg.Clients)
 	for i := 0; i < cfg.Clients; i++ {
 		go func(clientID int) {
 			defer wg.Done()
+			state := newTemplateState(runID, clientID, cfg.Value.Seed)
+			producerID := fmt.Appendf(nil, "%s-%d", runID, clientID)
 			for j := 0; j < perClient; j++ {
 				select {
 				case <-ctx.Done():
@@ -265,151 +605,111 @@ func runProducer(ctx context.Context, spec *scenario.ScenarioFile, sum *metrics.
 					return
 				default:
 				}
-				value, err := buildPayload(payloadTemplate)
+				state.seq = int64(j)
+				record, sendAt, err := payload.record(state)
 				if err != nil {
 					sum.AddError()
 					continue
 				}
-				start := time.Now()
-				res := client.ProduceSync(ctx, &kgo.Record{
-					Topic: topic,
-					Value: value,
-				})
-				if err := res.FirstErr(); err != nil {
+				if sendAt.IsZero() && interval > 0 {
+					sendAt = scheduleStart.Add(time.Duration(j)*interval + time.Duration(clientID)*interval/time.Duration(cfg.Clients))
+				}
+				if wait := time.Until(sendAt); !sendAt.IsZero() && wait > 0 {
+					select {
+					case <-ctx.Done():
+						sum.AddError()
+						return
+					case <-time.After(wait):
+					}
+				}
+				record.Topic = topic
+				record.Headers = append(record.Headers, buildHeaders(headers, state)...)
+				record.Headers = append(record.Headers, kgo.RecordHeader{Key: recordIDHeader, Value: fmt.Appendf(nil, "%s-%d-%d", runID, clientID, j)})
+				record.Headers = append(record.Headers, kgo.RecordHeader{Key: producerHeader, Value: producerID})
+				if err := embedChecksum(record, cfg.Checksum); err != nil {
 					sum.AddError()
-					if os.Getenv("KAF6_VERBOSE") == "1" {
-						fmt.Printf("producer[%d]: error: %v\n", clientID, err)
+					if verbose {
+						fmt.Printf("producer[%d]: %v\n", clientID, err)
 					}
 					continue
 				}
-				sum.AddProduce(time.Since(start))
-				if os.Getenv("KAF6_VERBOSE") == "1" && (sum.Produced%10) == 0 {
-					fmt.Printf("producer: sent=%d\n", sum.Produced)
+				// The send time is stamped last so that it is as close to the
+				// hand-off as possible; the checksum does not cover it.
+				if window != nil {
+					select {
+					case <-ctx.Done():
+						sum.AddError()
+						return
+					case window <- struct{}{}:
+					}
 				}
+				start := time.Now()
+				record.Headers = append(record.Headers, kgo.RecordHeader{Key: sentAtHeader, Value: strconv.AppendInt(nil, start.UnixNano(), 10)})
+				if window != nil {
+					client.Produce(ctx, record, func(record *kgo.Record, err error) {
+						finish(clientID, record, start, sendAt, err)
+						<-window
+					})
+					continue
+				}
+				record, err = client.ProduceSync(ctx, record).First()
+				finish(clientID, record, start, sendAt, err)
 			}
 		}(i)
 	}
 	wg.Wait()
-	return nil
+	// Every outstanding async record holds a window slot until its promise
+	// has run, so filling the window waits for all of them.
+	for range cap(window) {
+		window <- struct{}{}
+	}
+	result.Acked = acked.Load()
+	result.Duration = time.Since(scheduleStart)
+	recorder.fill(result)
+	return result, nil
 }
 
-func runConsumer(ctx context.Context, spec *scenario.ScenarioFile, sum *metrics.Summary, runID string) error {
-	cfg := spec.Scenarios.Consumer
-	if cfg.Clients <= 0 {
-		cfg.Clients = 1
-	}
-	if cfg.Limit <= 0 {
-		cfg.Limit = 1
-	}
-	groupID := resolvedGroupID(cfg.Group.ID, runID)
-	topic := resolveTopic(cfg.Topic, spec.Topics, runID)
-	if topic == "" {
-		return fmt.Errorf("consumer topic is required")
-	}
-	timeout := 30 * time.Second
-	if cfg.Timeout != "" {
-		if parsed, err := time.ParseDuration(cfg.Timeout); err == nil {
-			timeout = parsed
-		}
-	}
+func replaceRunID(input string, runID string) string {
+	return strings.ReplaceAll(input, "{{run_id}}", runID)
+}
 
-	options := []kgo.Opt{
-		kgo.SeedBrokers(spec.Brokers...),
-		kgo.ConsumerGroup(groupID),
-		kgo.ConsumeTopics(topic),
-		kgo.DisableIdempotentWrite(),
-		kgo.BlockRebalanceOnPoll(),
-		kgo.AllowAutoTopicCreation(),
-	}
-	if cfg.Offset == "" || cfg.Offset == "earliest" {
-		options = append(options, kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()))
-	}
-	if os.Getenv("KAF6_DEBUG") != "0" {
-		options = append(options, kgo.WithLogger(newDebugLogger("consumer")))
+func schemaSpecs(spec *scenario.ScenarioFile) []*scenario.SchemaSpec {
+	var out []*scenario.SchemaSpec
+	if spec.Scenarios.Producer != nil && spec.Scenarios.Producer.Value.Schema != nil {
+		out = append(out, spec.Scenarios.Producer.Value.Schema)
 	}
-	client, err := kgo.NewClient(options...)
-	if err != nil {
-		return err
+	if spec.Scenarios.Consumer != nil && spec.Scenarios.Consumer.Schema != nil {
+		out = append(out, spec.Scenarios.Consumer.Schema)
 	}
-
-	limit := cfg.Limit
-	consumed := 0
-	deadline := time.Now().Add(timeout)
-	debug := os.Getenv("KAF6_DEBUG") == "1"
-	idleDeadline := time.Now().Add(15 * time.Second)
-	if debug {
-		fmt.Printf("consumer debug: group=%s topic=%s limit=%d timeout=%s\n", groupID, topic, limit, timeout)
+	if spec.Scenarios.Compression != nil && spec.Scenarios.Compression.Value.Schema != nil {
+		out = append(out, spec.Scenarios.Compression.Value.Schema)
 	}
-
-	for consumed < limit {
-		if time.Now().After(deadline) {
-			if debug {
-				fmt.Printf("consumer debug: deadline exceeded after %s\n", timeout)
-			}
-			break
+	if search := spec.Scenarios.Search; search != nil {
+		if search.Producer != nil && search.Producer.Value.Schema != nil {
+			out = append(out, search.Producer.Value.Schema)
 		}
-		if time.Now().After(idleDeadline) {
-			if debug {
-				fmt.Printf("consumer debug: idle timeout reached\n")
-			}
-			break
-		}
-		pollStart := time.Now()
-		pollCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
-		fetches := client.PollFetches(pollCtx)
-		cancel()
-		pollLatency := time.Since(pollStart)
-		if pollCtx.Err() == context.DeadlineExceeded {
-			continue
+		if search.Consumer != nil && search.Consumer.Schema != nil {
+			out = append(out, search.Consumer.Schema)
 		}
-		if errs := fetches.Errors(); len(errs) > 0 {
-			sum.AddError()
-			if debug {
-				fmt.Printf("consumer debug: fetch errors: %+v\n", errs)
-			}
-			return fmt.Errorf("fetch errors: %+v", errs)
-		}
-		fetches.EachRecord(func(record *kgo.Record) {
-			consumed++
-			sum.AddConsumePoll(pollLatency)
-			sum.AddConsume(time.Since(record.Timestamp))
-			if os.Getenv("KAF6_VERBOSE") == "1" && (sum.Consumed%10) == 0 {
-				fmt.Printf("consumer: received=%d\n", sum.Consumed)
-			}
-			if debug {
-				fmt.Printf("consumer debug: record topic=%s partition=%d offset=%d\n", record.Topic, record.Partition, record.Offset)
-			}
-			idleDeadline = time.Now().Add(15 * time.Second)
-		})
 	}
-	if consumed < limit {
-		closeClient(client, debug)
-		return fmt.Errorf("consume timeout: got %d of %d", consumed, limit)
-	}
-	closeClient(client, debug)
-	return nil
+	return out
 }
 
-func buildPayload(template map[string]string) ([]byte, error) {
-	if len(template) == 0 {
-		return []byte(fmt.Sprintf(`{"uuid":"%d"}`, time.Now().UnixNano())), nil
-	}
-	payload := make(map[string]string, len(template))
-	for key, val := range template {
-		switch val {
-		case "{{uuid}}":
-			payload[key] = fmt.Sprintf("%d", time.Now().UnixNano())
-		case "{{now}}":
-			payload[key] = time.Now().UTC().Format(time.RFC3339Nano)
-		default:
-			payload[key] = val
+func usesEmbeddedRegistry(spec *scenario.ScenarioFile) bool {
+	for _, schema := range schemaSpecs(spec) {
+		if schema.Registry == "embedded" {
+			return true
 		}
 	}
-	return json.Marshal(payload)
+	return false
 }
 
-func replaceRunID(input string, runID string) string {
-	return strings.ReplaceAll(input, "{{run_id}}", runID)
+func setEmbeddedRegistry(spec *scenario.ScenarioFile, url string) {
+	for _, schema := range schemaSpecs(spec) {
+		if schema.Registry == "embedded" {
+			schema.Registry = url
+		}
+	}
 }
 
 func resolvedGroupID(input string, runID string) string {
@@ -430,44 +730,6 @@ func resolveTopic(input string, topics []scenario.TopicSpec, runID string) strin
 	return replaceRunID(name, runID)
 }
 
-func ensureTopics(ctx context.Context, spec *scenario.ScenarioFile, runID string, verbose bool) error {
-	if len(spec.Topics) == 0 {
-		return nil
-	}
-	client, err := kgo.NewClient(kgo.SeedBrokers(spec.Brokers...))
-	if err != nil {
-		return err
-	}
-	defer client.Close()
-	admin := kadm.NewClient(client)
-
-	for _, topic := range spec.Topics {
-		name := resolveTopic(topic.Name, nil, runID)
-		if name == "" {
-			continue
-		}
-		if topic.Recreate {
-			if verbose {
-				fmt.Printf("topic: deleting %s\n", name)
-			}
-			_, _ = admin.DeleteTopics(ctx, name)
-		}
-		if verbose {
-			fmt.Printf("topic: creating %s (partitions=%d)\n", name, topic.Partitions)
-		}
-		partitions := topic.Partitions
-		if partitions <= 0 {
-			partitions = 1
-		}
-		_, err := admin.CreateTopics(ctx, partitions, 1, nil, name)
-		if err != nil {
-			return fmt.Errorf("create topic %s: %w", name, err)
-		}
-	}
-	time.Sleep(2 * time.Second)
-	return nil
-}
-
 func closeClient(client *kgo.Client, debug bool) {
 	done := make(chan struct{})
 	go func() {
@@ -532,10 +794,7 @@ func evaluateChecks(spec *scenario.ScenarioFile, sum *metrics.Summary) map[strin
 	for _, check := range spec.Checks {
 		switch check.Type {
 		case "count_equals":
-			actual := int(sum.Consumed)
-			if check.Metric == "produced" {
-				actual = int(sum.Produced)
-			}
+			actual := metricValue(sum, check.Metric)
 			if actual == check.Expected {
 				out[check.Name] = "pass"
 			} else {
@@ -548,6 +807,39 @@ func evaluateChecks(spec *scenario.ScenarioFile, sum *metrics.Summary) map[strin
 	return out
 }
 
+func metricValue(sum *metrics.Summary, metric string) int {
+	switch metric {
+	case "produced":
+		return int(sum.Produced)
+	case "errors":
+		return int(sum.Errors)
+	case "header_mismatches":
+		return int(sum.HeaderMismatches)
+	case "schema_errors":
+		return int(sum.SchemaErrors)
+	case "rebalances":
+		return int(sum.Rebalances)
+	case "commit_mismatches":
+		return int(sum.CommitMismatches)
+	case "duplicates":
+		return int(sum.Duplicates)
+	case "max_lag":
+		return int(sum.MaxLag)
+	case "config_mismatches":
+		return int(sum.ConfigMismatches)
+	case "admin_failures":
+		return int(sum.AdminFailures)
+	case "group_failures":
+		return int(sum.GroupFailures)
+	case "corrupt_records":
+		return int(sum.Corrupted)
+	case "clock_skew":
+		return int(sum.ClockSkew)
+	default:
+		return int(sum.Consumed)
+	}
+}
+
 func checkConnectivity(brokers []string, timeout time.Duration) error {
 	if len(brokers) == 0 {
 		return fmt.Errorf("no brokers configured")
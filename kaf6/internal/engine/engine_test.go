@@ -0,0 +1,160 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package engine
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"kaf6/internal/metrics"
+	"kaf6/internal/scenario"
+)
+
+func TestRunDeadline(t *testing.T) {
+	cases := []struct {
+		name string
+		spec scenario.ScenarioFile
+		want time.Duration
+	}{
+		{name: "default", want: minRunDeadline},
+		{name: "explicit timeout", spec: scenario.ScenarioFile{Timeout: "45m"}, want: 45 * time.Minute},
+		{
+			name: "long duration consumer",
+			spec: scenario.ScenarioFile{Scenarios: scenario.ScenarioCollection{
+				Consumer: &scenario.ConsumerScenario{Until: "duration", Duration: "10m"},
+			}},
+			want: 10*time.Minute + runDeadlineMargin,
+		},
+		{
+			name: "long catch-up with resume",
+			spec: scenario.ScenarioFile{Scenarios: scenario.ScenarioCollection{
+				Consumer: &scenario.ConsumerScenario{Timeout: "5m", Resume: true},
+			}},
+			want: 10*time.Minute + runDeadlineMargin,
+		},
+		{
+			name: "consumer and compression",
+			spec: scenario.ScenarioFile{Scenarios: scenario.ScenarioCollection{
+				Consumer:    &scenario.ConsumerScenario{Timeout: "90s"},
+				Compression: &scenario.CompressionScenario{},
+			}},
+			want: 90*time.Second + 30*time.Second + runDeadlineMargin,
+		},
+		{
+			name: "paced producer",
+			spec: scenario.ScenarioFile{Scenarios: scenario.ScenarioCollection{
+				Producer: &scenario.ProducerScenario{Messages: 60000, Clients: 4, RatePerS: 100},
+			}},
+			want: 10*time.Minute + runDeadlineMargin,
+		},
+		{
+			name: "paced producer within explicit timeout",
+			spec: scenario.ScenarioFile{Timeout: "15m", Scenarios: scenario.ScenarioCollection{
+				Producer: &scenario.ProducerScenario{Messages: 60000, RatePerS: 100},
+			}},
+			want: 15 * time.Minute,
+		},
+		{
+			name: "search",
+			spec: scenario.ScenarioFile{Scenarios: scenario.ScenarioCollection{
+				Search: &scenario.SearchScenario{MaxProbes: 2, StepDuration: "1m", Cooldown: "10s"},
+			}},
+			want: 2*(time.Minute+10*time.Second+90*time.Second) + runDeadlineMargin,
+		},
+		{
+			name: "verify phase",
+			spec: scenario.ScenarioFile{Phase: "verify", VerifyTimeout: 20 * time.Minute},
+			want: 20*time.Minute + runDeadlineMargin,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := runDeadline(&tc.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Fatalf("deadline = %s, want %s", got, tc.want)
+			}
+		})
+	}
+	if _, err := runDeadline(&scenario.ScenarioFile{Timeout: "soon"}); err == nil {
+		t.Fatal("invalid timeout accepted")
+	}
+	short := &scenario.ScenarioFile{Timeout: "5m", Scenarios: scenario.ScenarioCollection{
+		Producer: &scenario.ProducerScenario{Messages: 60000, RatePerS: 100},
+	}}
+	if _, err := runDeadline(short); err == nil {
+		t.Fatal("timeout shorter than the paced schedule accepted")
+	}
+}
+
+func TestResultFinishStatus(t *testing.T) {
+	checked := &scenario.ScenarioFile{Checks: []scenario.CheckSpec{
+		{Name: "all produced", Type: "count_equals", Metric: "produced", Expected: 10},
+	}}
+	cases := []struct {
+		name         string
+		spec         *scenario.ScenarioFile
+		connectivity string
+		runErr       error
+		sum          *metrics.Summary
+		search       *SearchResult
+		want         string
+	}{
+		{name: "clean run", want: "pass"},
+		{name: "run error", runErr: errors.New("boom"), want: "fail"},
+		{name: "connectivity failed", connectivity: "fail", want: "fail"},
+		{name: "errors", sum: &metrics.Summary{Errors: 1}, want: "fail"},
+		{name: "header mismatches", sum: &metrics.Summary{HeaderMismatches: 1}, want: "fail"},
+		{name: "duplicates", sum: &metrics.Summary{Duplicates: 1}, want: "fail"},
+		{name: "group failures", sum: &metrics.Summary{GroupFailures: 1}, want: "fail"},
+		{name: "search failed", search: &SearchResult{Status: "fail"}, want: "fail"},
+		{name: "search passed", search: &SearchResult{Status: "pass"}, want: "pass"},
+		{name: "check failed", spec: checked, sum: &metrics.Summary{Produced: 9}, want: "fail"},
+		{name: "check passed", spec: checked, sum: &metrics.Summary{Produced: 10}, want: "pass"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			spec := tc.spec
+			if spec == nil {
+				spec = &scenario.ScenarioFile{}
+			}
+			connectivity := tc.connectivity
+			if connectivity == "" {
+				connectivity = "ok"
+			}
+			result := &Result{ConnectivityStatus: connectivity, Search: tc.search, StartedAt: time.Now()}
+			sum := tc.sum
+			if sum == nil {
+				sum = &metrics.Summary{}
+			}
+			result.finish(spec, sum, tc.runErr)
+			if result.Status != tc.want {
+				t.Fatalf("got status %s, want %s", result.Status, tc.want)
+			}
+			if result.Produced != sum.Produced || result.Errors != sum.Errors {
+				t.Fatalf("counters not copied: produced %d errors %d", result.Produced, result.Errors)
+			}
+			if tc.runErr != nil && result.RunError != tc.runErr.Error() {
+				t.Fatalf("got run error %q, want %q", result.RunError, tc.runErr.Error())
+			}
+		})
+	}
+}
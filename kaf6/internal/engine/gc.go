@@ -0,0 +1,201 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+var (
+	// kaf6 run IDs: 20060102-150405 in local time.
+	runIDSuffix = regexp.MustCompile(`-(\d{8}-\d{6})$`)
+	// k6 run IDs: epoch millis and a random suffix.
+	k6RunIDSuffix = regexp.MustCompile(`-(\d{13})-\d{1,6}$`)
+)
+
+// gcPrefixes are the name prefixes that the bundled suites, the k6 scripts and
+// the default consumer group use for run-scoped topics and groups. A run ID
+// suffix alone is not enough: other tools name things the same way.
+var gcPrefixes = []string{"kaf6-", "smoke-", "diagnose-", "compression-", "acl-test-", "acl-group-"}
+
+// GCCandidate is a topic or consumer group whose name ends in a run ID.
+// Action is "deleted", "would delete", "kept" (younger than the age filter or
+// still active) or "failed".
+type GCCandidate struct {
+	Kind   string
+	Name   string
+	RunAt  time.Time
+	Action string
+	Error  string
+}
+
+// GCOptions filters what gc deletes. Pattern, when set, is a regular
+// expression that replaces the built-in name prefixes; names must still end
+// in a run ID.
+type GCOptions struct {
+	OlderThan time.Duration
+	DryRun    bool
+	Pattern   string
+}
+
+// runTime parses the run ID embedded at the end of a topic or group name.
+func runTime(name string) (time.Time, bool) {
+	if match := runIDSuffix.FindStringSubmatch(name); match != nil {
+		at, err := time.ParseInLocation("20060102-150405", match[1], time.Local)
+		return at, err == nil
+	}
+	if match := k6RunIDSuffix.FindStringSubmatch(name); match != nil {
+		millis, err := strconv.ParseInt(match[1], 10, 64)
+		return time.UnixMilli(millis), err == nil
+	}
+	return time.Time{}, false
+}
+
+// gcRunTime reports whether gc may touch name and when its run started.
+func gcRunTime(name string, pattern *regexp.Regexp) (time.Time, bool) {
+	if pattern != nil {
+		if !pattern.MatchString(name) {
+			return time.Time{}, false
+		}
+	} else if !hasGCPrefix(name) {
+		return time.Time{}, false
+	}
+	return runTime(name)
+}
+
+func hasGCPrefix(name string) bool {
+	for _, prefix := range gcPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// CollectGarbage lists the topics and consumer groups left behind by kaf6 and
+// k6 runs and deletes those older than opts.OlderThan. Groups with active
+// members are kept.
+func CollectGarbage(ctx context.Context, brokers []string, opts GCOptions) ([]GCCandidate, error) {
+	var pattern *regexp.Regexp
+	if opts.Pattern != "" {
+		var err error
+		if pattern, err = regexp.Compile(opts.Pattern); err != nil {
+			return nil, fmt.Errorf("pattern: %w", err)
+		}
+	}
+	client, err := kgo.NewClient(kgo.SeedBrokers(brokers...))
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	admin := kadm.NewClient(client)
+
+	topics, err := admin.ListTopics(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list topics: %w", err)
+	}
+	groups, err := admin.ListGroups(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list groups: %w", err)
+	}
+	cutoff := time.Now().Add(-opts.OlderThan)
+	var out []GCCandidate
+	var deleteTopics, deleteGroups []string
+	for _, name := range topics.Names() {
+		at, ok := gcRunTime(name, pattern)
+		if !ok {
+			continue
+		}
+		candidate := GCCandidate{Kind: "topic", Name: name, RunAt: at, Action: "kept"}
+		if at.Before(cutoff) {
+			candidate.Action = "would delete"
+			deleteTopics = append(deleteTopics, name)
+		}
+		out = append(out, candidate)
+	}
+	for _, listed := range groups.Sorted() {
+		at, ok := gcRunTime(listed.Group, pattern)
+		if !ok {
+			continue
+		}
+		candidate := GCCandidate{Kind: "group", Name: listed.Group, RunAt: at, Action: "kept"}
+		switch {
+		case !at.Before(cutoff):
+		case listed.State != "" && listed.State != "Empty" && listed.State != "Dead":
+			candidate.Error = "group is " + listed.State
+		default:
+			candidate.Action = "would delete"
+			deleteGroups = append(deleteGroups, listed.Group)
+		}
+		out = append(out, candidate)
+	}
+	if opts.DryRun {
+		return out, nil
+	}
+
+	failed := map[string]string{}
+	if len(deleteGroups) > 0 {
+		resp, err := admin.DeleteGroups(ctx, deleteGroups...)
+		for _, group := range deleteGroups {
+			deleted, ok := resp[group]
+			switch {
+			case err != nil:
+				failed["group/"+group] = err.Error()
+			case !ok:
+				failed["group/"+group] = "no response"
+			case deleted.Err != nil && !errors.Is(deleted.Err, kerr.GroupIDNotFound):
+				failed["group/"+group] = deleted.Err.Error()
+			}
+		}
+	}
+	if len(deleteTopics) > 0 {
+		resp, err := admin.DeleteTopics(ctx, deleteTopics...)
+		for _, topic := range deleteTopics {
+			deleted, ok := resp[topic]
+			switch {
+			case err != nil:
+				failed["topic/"+topic] = err.Error()
+			case !ok:
+				failed["topic/"+topic] = "no response"
+			case deleted.Err != nil && !errors.Is(deleted.Err, kerr.UnknownTopicOrPartition):
+				failed["topic/"+topic] = deleted.Err.Error()
+			}
+		}
+	}
+	for i := range out {
+		if out[i].Action != "would delete" {
+			continue
+		}
+		out[i].Action = "deleted"
+		if reason, ok := failed[out[i].Kind+"/"+out[i].Name]; ok {
+			out[i].Action = "failed"
+			out[i].Error = reason
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,67 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package engine
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestGCRunTime(t *testing.T) {
+	kaf6Run := time.Date(2026, 3, 4, 5, 6, 7, 0, time.Local)
+	k6Run := time.UnixMilli(1767225600123)
+	tests := []struct {
+		name    string
+		pattern string
+		want    time.Time
+		match   bool
+	}{
+		{"smoke-single-20260304-050607", "", kaf6Run, true},
+		{"kaf6-group-20260304-050607", "", kaf6Run, true},
+		{"compression-20260304-050607", "", kaf6Run, true},
+		{"smoke-group-1767225600123-42", "", k6Run, true},
+		{"acl-group-1767225600123-999999", "", k6Run, true},
+		// Run ID suffixes on names other tools own.
+		{"orders-20260304-050607", "", time.Time{}, false},
+		{"billing-backup-1767225600123-1", "", time.Time{}, false},
+		{"connect-offsets-20260304-050607", "", time.Time{}, false},
+		{"__consumer_offsets", "", time.Time{}, false},
+		// A known prefix without a run ID.
+		{"smoke-single", "", time.Time{}, false},
+		{"smoke-20260304", "", time.Time{}, false},
+		{"kaf6-group-20260304-050607-x", "", time.Time{}, false},
+		{"smoke-1767225600123-1234567", "", time.Time{}, false},
+		// An explicit pattern replaces the prefixes but keeps the run ID.
+		{"orders-20260304-050607", "^orders-", kaf6Run, true},
+		{"smoke-single-20260304-050607", "^orders-", time.Time{}, false},
+		{"orders-latest", "^orders-", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+tt.pattern, func(t *testing.T) {
+			var pattern *regexp.Regexp
+			if tt.pattern != "" {
+				pattern = regexp.MustCompile(tt.pattern)
+			}
+			at, ok := gcRunTime(tt.name, pattern)
+			if ok != tt.match || !at.Equal(tt.want) {
+				t.Fatalf("gcRunTime(%q) = %v, %v, want %v, %v", tt.name, at, ok, tt.want, tt.match)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package engine
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+
+	"kaf6/internal/scenario"
+)
+
+func groupBalancer(name string) (kgo.GroupBalancer, error) {
+	switch name {
+	case "range":
+		return kgo.RangeBalancer(), nil
+	case "roundrobin":
+		return kgo.RoundRobinBalancer(), nil
+	case "sticky":
+		return kgo.StickyBalancer(), nil
+	case "cooperative-sticky":
+		return kgo.CooperativeStickyBalancer(), nil
+	default:
+		return nil, fmt.Errorf("unknown group balancer: %s", name)
+	}
+}
+
+// groupProtocol decides which group protocol the consumers run. The KIP-848
+// "consumer" protocol is only used when every broker advertises
+// ConsumerGroupHeartbeat v1; otherwise the run falls back to the classic
+// protocol and says so in the result.
+func groupProtocol(ctx context.Context, brokers []string, group scenario.GroupSpec) (string, bool, error) {
+	switch group.Protocol {
+	case "", "classic":
+		return "classic", false, nil
+	case "consumer":
+	default:
+		return "", false, fmt.Errorf("unknown group protocol: %s", group.Protocol)
+	}
+	switch group.Balancer {
+	case "", "range", "sticky":
+	default:
+		return "", false, fmt.Errorf("group protocol consumer supports balancer range or sticky, got %s", group.Balancer)
+	}
+	client, err := kgo.NewClient(kgo.SeedBrokers(brokers...))
+	if err != nil {
+		return "", false, err
+	}
+	defer client.Close()
+	versions, err := kadm.NewClient(client).ApiVersions(ctx)
+	if err != nil {
+		return "", false, fmt.Errorf("api versions: %w", err)
+	}
+	supported := len(versions) > 0
+	versions.Each(func(v kadm.BrokerApiVersions) {
+		if version, ok := v.KeyMaxVersion(int16(kmsg.ConsumerGroupHeartbeat)); v.Err != nil || !ok || version < 1 {
+			supported = false
+		}
+	})
+	if !supported {
+		return "classic", true, nil
+	}
+	return "consumer", false, nil
+}
+
+// groupOptions builds the balancer, protocol and static membership options
+// for consumer client i.
+func groupOptions(group scenario.GroupSpec, protocol string, runID string, clients int, i int) ([]kgo.Opt, error) {
+	var options []kgo.Opt
+	balancer := group.Balancer
+	if balancer == "" && protocol == "consumer" {
+		balancer = "sticky"
+	}
+	if balancer != "" {
+		b, err := groupBalancer(balancer)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, kgo.Balancers(b))
+	}
+	if protocol == "consumer" {
+		options = append(options, kgo.ServerSideBalancer())
+	}
+	if group.InstanceID != "" {
+		instanceID := replaceRunID(group.InstanceID, runID)
+		if clients > 1 {
+			instanceID = fmt.Sprintf("%s-%d", instanceID, i)
+		}
+		options = append(options, kgo.InstanceID(instanceID))
+	}
+	return options, nil
+}
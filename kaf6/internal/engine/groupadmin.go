@@ -0,0 +1,258 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"kaf6/internal/metrics"
+	"kaf6/internal/scenario"
+)
+
+// GroupStepResult is one consumer group administration step, reported like
+// AdminStepResult.
+type GroupStepResult struct {
+	Op       string
+	Group    string
+	Topic    string
+	Latency  time.Duration
+	Detail   string
+	Error    string
+	Failures []string
+	Status   string
+}
+
+type groupOutcome struct {
+	detail  string
+	listed  bool
+	state   string
+	members int
+	offsets map[int32]int64
+}
+
+var groupOps = map[string]bool{
+	"list_groups":     true,
+	"describe_groups": true,
+	"fetch_offsets":   true,
+	"alter_offsets":   true,
+	"reset_offsets":   true,
+	"delete_groups":   true,
+}
+
+func runGroupSteps(ctx context.Context, spec *scenario.ScenarioFile, sum *metrics.Summary, runID string, verbose bool) ([]GroupStepResult, error) {
+	cfg := spec.Scenarios.Groups
+	if len(cfg.Steps) == 0 {
+		return nil, fmt.Errorf("groups steps are required")
+	}
+	for i, step := range cfg.Steps {
+		if !groupOps[step.Op] {
+			return nil, fmt.Errorf("groups step %d: unknown op %q", i+1, step.Op)
+		}
+		if step.Op == "alter_offsets" && len(step.Offsets) == 0 {
+			return nil, fmt.Errorf("groups step %d: alter_offsets needs offsets", i+1)
+		}
+	}
+	client, err := kgo.NewClient(kgo.SeedBrokers(spec.Brokers...))
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	admin := kadm.NewClient(client)
+
+	results := make([]GroupStepResult, 0, len(cfg.Steps))
+	for _, step := range cfg.Steps {
+		result := GroupStepResult{
+			Op:    step.Op,
+			Group: resolvedGroupID(step.Group, runID),
+		}
+		switch step.Op {
+		case "fetch_offsets", "alter_offsets", "reset_offsets":
+			result.Topic = resolveTopic(step.Topic, spec.Topics, runID)
+		}
+		start := time.Now()
+		outcome, err := runGroupStep(ctx, admin, step, result.Group, result.Topic)
+		result.Latency = time.Since(start)
+		result.Detail = outcome.detail
+		result.Error = errorText(err)
+		result.Failures = checkGroupStep(step.Expect, outcome, err)
+		result.Status = "pass"
+		if len(result.Failures) > 0 {
+			result.Status = "fail"
+			sum.AddGroupFailure()
+		}
+		if verbose {
+			fmt.Printf("groups: %s %s %s (%s) %s\n", step.Op, result.Group, result.Status, result.Latency.Round(time.Millisecond), strings.Join(result.Failures, "; "))
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func runGroupStep(ctx context.Context, admin *kadm.Client, step scenario.GroupStep, group string, topic string) (groupOutcome, error) {
+	var out groupOutcome
+	switch step.Op {
+	case "list_groups":
+		listed, err := admin.ListGroups(ctx)
+		if err != nil {
+			return out, err
+		}
+		found, ok := listed[group]
+		out.listed = ok
+		out.state = found.State
+		out.detail = fmt.Sprintf("groups=%d listed=%t", len(listed), ok)
+		if ok && found.State != "" {
+			out.detail += " state=" + found.State
+		}
+		return out, nil
+	case "describe_groups":
+		described, err := admin.DescribeGroups(ctx, group)
+		if err != nil {
+			return out, err
+		}
+		found, err := described.On(group, nil)
+		if err != nil {
+			return out, err
+		}
+		out.state = found.State
+		out.members = len(found.Members)
+		parts := []string{fmt.Sprintf("state=%s members=%d", found.State, len(found.Members))}
+		if found.Protocol != "" {
+			parts = append(parts, "protocol="+found.Protocol)
+		}
+		for _, member := range found.Members {
+			parts = append(parts, fmt.Sprintf("%s: %s", member.ClientID, formatAssignment(member.Assigned)))
+		}
+		out.detail = strings.Join(parts, "; ")
+		return out, found.Err
+	case "fetch_offsets":
+		fetched, err := admin.FetchOffsets(ctx, group)
+		if err != nil {
+			return out, err
+		}
+		out.offsets = make(map[int32]int64)
+		fetched.Each(func(offset kadm.OffsetResponse) {
+			if offset.Topic == topic && offset.Err == nil {
+				out.offsets[offset.Partition] = offset.At
+			}
+		})
+		out.detail = formatPartitionOffsets(out.offsets)
+		return out, fetched.Error()
+	case "alter_offsets", "reset_offsets":
+		var offsets kadm.Offsets
+		if step.Op == "alter_offsets" {
+			for partition, at := range step.Offsets {
+				offsets.Add(kadm.Offset{Topic: topic, Partition: partition, At: at, LeaderEpoch: -1})
+			}
+		} else {
+			targets, err := resetTargets(ctx, admin, topic, step.Offset)
+			if err != nil {
+				return out, err
+			}
+			targets.Each(func(target kadm.ListedOffset) {
+				offsets.Add(kadm.Offset{Topic: topic, Partition: target.Partition, At: target.Offset, LeaderEpoch: -1})
+			})
+		}
+		committed, err := admin.CommitOffsets(ctx, group, offsets)
+		if err != nil {
+			return out, err
+		}
+		out.offsets = make(map[int32]int64)
+		committed.Each(func(offset kadm.OffsetResponse) {
+			if offset.Err == nil {
+				out.offsets[offset.Partition] = offset.At
+			}
+		})
+		out.detail = formatPartitionOffsets(out.offsets)
+		return out, committed.Error()
+	case "delete_groups":
+		resp, err := admin.DeleteGroups(ctx, group)
+		if err != nil {
+			return out, err
+		}
+		deleted, ok := resp[group]
+		if !ok {
+			return out, errors.New("group not in response")
+		}
+		return out, deleted.Err
+	}
+	return out, fmt.Errorf("unknown groups op %q", step.Op)
+}
+
+// resetTargets resolves a reset target the way kafka-consumer-groups does:
+// earliest, latest, or the first offset at or after a timestamp.
+func resetTargets(ctx context.Context, admin *kadm.Client, topic string, target string) (kadm.ListedOffsets, error) {
+	var listed kadm.ListedOffsets
+	var err error
+	switch {
+	case target == "" || target == "earliest":
+		listed, err = admin.ListStartOffsets(ctx, topic)
+	case target == "latest":
+		listed, err = admin.ListEndOffsets(ctx, topic)
+	case strings.HasPrefix(target, "timestamp:"):
+		at, parseErr := time.Parse(time.RFC3339, strings.TrimPrefix(target, "timestamp:"))
+		if parseErr != nil {
+			return nil, fmt.Errorf("reset_offsets timestamp: %w", parseErr)
+		}
+		listed, err = admin.ListOffsetsAfterMilli(ctx, at.UnixMilli(), topic)
+	default:
+		return nil, fmt.Errorf("reset_offsets offset must be earliest, latest or timestamp:<RFC3339>: %s", target)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return listed, listed.Error()
+}
+
+func formatAssignment(assigned kadm.GroupMemberAssignment) string {
+	consumer, ok := assigned.AsConsumer()
+	if !ok {
+		return "no consumer assignment"
+	}
+	parts := make([]string, 0, len(consumer.Topics))
+	for _, topic := range consumer.Topics {
+		partitions := append([]int32(nil), topic.Partitions...)
+		sort.Slice(partitions, func(i, j int) bool { return partitions[i] < partitions[j] })
+		parts = append(parts, fmt.Sprintf("%s%v", topic.Topic, partitions))
+	}
+	if len(parts) == 0 {
+		return "nothing assigned"
+	}
+	return strings.Join(parts, " ")
+}
+
+func checkGroupStep(expect scenario.GroupExpect, outcome groupOutcome, err error) []string {
+	failures := expectError(expect.Error, err)
+	if expect.Listed != nil && outcome.listed != *expect.Listed {
+		failures = append(failures, fmt.Sprintf("listed: expected %t, got %t", *expect.Listed, outcome.listed))
+	}
+	if expect.State != "" && !strings.EqualFold(outcome.state, expect.State) {
+		failures = append(failures, fmt.Sprintf("state: expected %s, got %s", expect.State, displayValue(outcome.state)))
+	}
+	if expect.Members != nil && outcome.members != *expect.Members {
+		failures = append(failures, fmt.Sprintf("members: expected %d, got %d", *expect.Members, outcome.members))
+	}
+	return append(failures, expectOffsets(expect.Offsets, outcome.offsets)...)
+}
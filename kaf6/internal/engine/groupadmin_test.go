@@ -0,0 +1,74 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package engine
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/twmb/franz-go/pkg/kerr"
+
+	"kaf6/internal/scenario"
+)
+
+func TestCheckGroupStep(t *testing.T) {
+	yes, no := true, false
+	two := 2
+	cases := []struct {
+		name    string
+		expect  scenario.GroupExpect
+		outcome groupOutcome
+		err     error
+		want    []string
+	}{
+		{name: "nothing expected"},
+		{
+			name:    "all match",
+			expect:  scenario.GroupExpect{Listed: &yes, State: "stable", Members: &two, Offsets: map[int32]int64{0: 5}},
+			outcome: groupOutcome{listed: true, state: "Stable", members: 2, offsets: map[int32]int64{0: 5, 1: 3}},
+		},
+		{
+			name:    "mismatches",
+			expect:  scenario.GroupExpect{Listed: &no, State: "Empty", Members: &two},
+			outcome: groupOutcome{listed: true, members: 1},
+			want: []string{
+				"listed: expected false, got true",
+				"state: expected Empty, got (unset)",
+				"members: expected 2, got 1",
+			},
+		},
+		{
+			name:   "expected error",
+			expect: scenario.GroupExpect{Error: "GROUP_ID_NOT_FOUND"},
+			err:    kerr.GroupIDNotFound,
+		},
+		{
+			name: "unexpected error",
+			err:  errors.New("boom"),
+			want: []string{"unexpected error: boom"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := checkGroupStep(tc.expect, tc.outcome, tc.err); !slices.Equal(got, tc.want) {
+				t.Fatalf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
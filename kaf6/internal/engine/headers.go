@@ -0,0 +1,214 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package engine
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// headerSpec is one parsed header entry. A key listed with an array value
+// yields one headerSpec per element, in order. Null marks a header sent with
+// no value at all, as opposed to an empty one.
+type headerSpec struct {
+	Key      string
+	Value    []byte
+	Template string
+	Null     bool
+}
+
+// recordIDHeader carries the run-unique ID every produced record gets, so a
+// later process can recognise the record regardless of where it landed.
+const recordIDHeader = "kaf6-id"
+
+// sentAtHeader carries the producer's wall clock in Unix nanoseconds, taken
+// right before the record is handed to the client. producerHeader names the
+// producer client that stamped it.
+const (
+	sentAtHeader   = "kaf6-sent-at"
+	producerHeader = "kaf6-producer"
+)
+
+// parseHeaders accepts a scenario header map where each value is a string
+// (expanded as a template), null (no value), "" (empty value),
+// {"base64": "..."} (binary value) or an array of those (repeated key).
+func parseHeaders(raw map[string]any) ([]headerSpec, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	keys := make([]string, 0, len(raw))
+	for key := range raw {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	out := make([]headerSpec, 0, len(raw))
+	for _, key := range keys {
+		values, ok := raw[key].([]any)
+		if !ok {
+			values = []any{raw[key]}
+		}
+		for _, value := range values {
+			spec, err := parseHeaderValue(key, value)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, spec)
+		}
+	}
+	return out, nil
+}
+
+func parseHeaderValue(key string, value any) (headerSpec, error) {
+	switch typed := value.(type) {
+	case nil:
+		return headerSpec{Key: key, Null: true}, nil
+	case string:
+		if strings.Contains(typed, "{{") {
+			return headerSpec{Key: key, Template: typed}, nil
+		}
+		return headerSpec{Key: key, Value: []byte(typed)}, nil
+	case map[string]any:
+		encoded, ok := typed["base64"].(string)
+		if !ok {
+			return headerSpec{}, fmt.Errorf("header %s: object values require a base64 field", key)
+		}
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return headerSpec{}, fmt.Errorf("header %s: %w", key, err)
+		}
+		return headerSpec{Key: key, Value: decoded}, nil
+	default:
+		return headerSpec{Key: key, Value: []byte(fmt.Sprint(typed))}, nil
+	}
+}
+
+func (h headerSpec) literal() []byte {
+	if h.Template != "" {
+		return []byte(h.Template)
+	}
+	return h.Value
+}
+
+func buildHeaders(specs []headerSpec, state *templateState) []kgo.RecordHeader {
+	if len(specs) == 0 {
+		return nil
+	}
+	out := make([]kgo.RecordHeader, 0, len(specs))
+	for _, spec := range specs {
+		value := spec.Value
+		if spec.Template != "" {
+			value = []byte(expandTemplate(spec.Template, state))
+		}
+		out = append(out, kgo.RecordHeader{Key: spec.Key, Value: value})
+	}
+	return out
+}
+
+// headerCheck is one expected header value on the consumer side. A templated
+// value is matched by pattern, see templateMatcher.
+type headerCheck struct {
+	spec    headerSpec
+	pattern *regexp.Regexp
+}
+
+func headerChecks(specs []headerSpec, runID string) []headerCheck {
+	if len(specs) == 0 {
+		return nil
+	}
+	out := make([]headerCheck, 0, len(specs))
+	for _, spec := range specs {
+		check := headerCheck{spec: spec}
+		if spec.Template != "" {
+			check.pattern = templateMatcher(spec.Template, runID)
+		}
+		out = append(out, check)
+	}
+	return out
+}
+
+// compareHeaders checks received headers against the expected ones. Values
+// of the same key are compared in order. A null value only matches a header
+// without a value, and an empty value only one with an empty value.
+func compareHeaders(expected []headerCheck, received []kgo.RecordHeader) error {
+	if len(expected) == 0 {
+		return nil
+	}
+	byKey := make(map[string][][]byte)
+	for _, header := range received {
+		byKey[header.Key] = append(byKey[header.Key], header.Value)
+	}
+	wanted := make(map[string][]headerCheck)
+	var keys []string
+	for _, check := range expected {
+		if _, ok := wanted[check.spec.Key]; !ok {
+			keys = append(keys, check.spec.Key)
+		}
+		wanted[check.spec.Key] = append(wanted[check.spec.Key], check)
+	}
+	for _, key := range keys {
+		checks := wanted[key]
+		got := byKey[key]
+		if len(got) != len(checks) {
+			return fmt.Errorf("header %s: expected %d values, got %d", key, len(checks), len(got))
+		}
+		for i, check := range checks {
+			switch {
+			case check.spec.Null && got[i] != nil:
+				return fmt.Errorf("header %s[%d]: expected null, got %q", key, i, got[i])
+			case check.spec.Null:
+			case got[i] == nil:
+				return fmt.Errorf("header %s[%d]: expected %q, got null", key, i, check.spec.literal())
+			case check.pattern != nil && !check.pattern.Match(got[i]):
+				return fmt.Errorf("header %s[%d]: expected %q, got %q", key, i, check.spec.Template, got[i])
+			case check.pattern == nil && !bytes.Equal(got[i], check.spec.Value):
+				return fmt.Errorf("header %s[%d]: expected %q, got %q", key, i, check.spec.Value, got[i])
+			}
+		}
+	}
+	return nil
+}
+
+// sendTime returns the send time and producer a record was stamped with, if
+// it carries a valid sentAtHeader.
+func sendTime(record *kgo.Record) (time.Time, string, bool) {
+	var sentAt time.Time
+	var producer string
+	found := false
+	for _, header := range record.Headers {
+		switch header.Key {
+		case sentAtHeader:
+			nanos, err := strconv.ParseInt(string(header.Value), 10, 64)
+			if err != nil {
+				return time.Time{}, "", false
+			}
+			sentAt = time.Unix(0, nanos)
+			found = true
+		case producerHeader:
+			producer = string(header.Value)
+		}
+	}
+	return sentAt, producer, found
+}
@@ -0,0 +1,157 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package engine
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func TestParseHeaders(t *testing.T) {
+	got, err := parseHeaders(map[string]any{
+		"trace":  "{{run_id}}-{{seq}}",
+		"tag":    []any{"a", "b"},
+		"blob":   map[string]any{"base64": "AP8="},
+		"empty":  "",
+		"absent": nil,
+		"count":  float64(3),
+	})
+	if err != nil {
+		t.Fatalf("parseHeaders: %v", err)
+	}
+	want := []headerSpec{
+		{Key: "absent", Null: true},
+		{Key: "blob", Value: []byte{0x00, 0xff}},
+		{Key: "count", Value: []byte("3")},
+		{Key: "empty", Value: []byte{}},
+		{Key: "tag", Value: []byte("a")},
+		{Key: "tag", Value: []byte("b")},
+		{Key: "trace", Template: "{{run_id}}-{{seq}}"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("parseHeaders = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseHeadersErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  map[string]any
+	}{
+		{"object without base64", map[string]any{"k": map[string]any{"hex": "00"}}},
+		{"bad base64", map[string]any{"k": map[string]any{"base64": "!!"}}},
+		{"bad array element", map[string]any{"k": []any{"a", map[string]any{}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseHeaders(tt.raw); err == nil || !strings.HasPrefix(err.Error(), "header k:") {
+				t.Fatalf("parseHeaders error = %v", err)
+			}
+		})
+	}
+}
+
+func TestCompareHeaders(t *testing.T) {
+	t.Setenv("KAF6_TEST_REGION", "eu-1")
+	specs, err := parseHeaders(map[string]any{
+		"trace":  "{{run_id}}-{{seq}}",
+		"region": "{{env KAF6_TEST_REGION}}",
+		"id":     "{{uuid}}",
+		"tag":    []any{"a", "b"},
+		"blob":   map[string]any{"base64": "AP8="},
+		"empty":  "",
+		"absent": nil,
+	})
+	if err != nil {
+		t.Fatalf("parseHeaders: %v", err)
+	}
+	expected := headerChecks(specs, "run1")
+	base := []kgo.RecordHeader{
+		{Key: "trace", Value: []byte("run1-42")},
+		{Key: "region", Value: []byte("eu-1")},
+		{Key: "id", Value: []byte("0f8fad5b-d9cb-469f-a165-70867728950e")},
+		{Key: "tag", Value: []byte("a")},
+		{Key: "tag", Value: []byte("b")},
+		{Key: "blob", Value: []byte{0x00, 0xff}},
+		{Key: "empty", Value: []byte{}},
+		{Key: "absent", Value: nil},
+		{Key: "kaf6-id", Value: []byte("run1-0-42")},
+	}
+	with := func(key string, values ...[]byte) []kgo.RecordHeader {
+		var out []kgo.RecordHeader
+		for _, header := range base {
+			if header.Key != key {
+				out = append(out, header)
+			}
+		}
+		for _, value := range values {
+			out = append(out, kgo.RecordHeader{Key: key, Value: value})
+		}
+		return out
+	}
+	tests := []struct {
+		name     string
+		received []kgo.RecordHeader
+		want     string
+	}{
+		{"match", base, ""},
+		{"repeated key out of order", with("tag", []byte("b"), []byte("a")), `header tag[0]: expected "a", got "b"`},
+		{"repeated key missing value", with("tag", []byte("a")), "header tag: expected 2 values, got 1"},
+		{"binary mismatch", with("blob", []byte{0x00}), `header blob[0]: expected "\x00\xff", got "\x00"`},
+		{"empty sent as null", with("empty", nil), `header empty[0]: expected "", got null`},
+		{"null sent as empty", with("absent", []byte{}), `header absent[0]: expected null, got ""`},
+		{"run id mismatch", with("trace", []byte("run2-42")), `header trace[0]: expected "{{run_id}}-{{seq}}", got "run2-42"`},
+		{"env mismatch", with("region", []byte("us-1")), `header region[0]: expected "{{env KAF6_TEST_REGION}}", got "us-1"`},
+		{"uuid shape", with("id", []byte("not-a-uuid")), `header id[0]: expected "{{uuid}}", got "not-a-uuid"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := compareHeaders(expected, tt.received)
+			switch {
+			case tt.want == "" && err != nil:
+				t.Fatalf("compareHeaders: %v", err)
+			case tt.want != "" && (err == nil || err.Error() != tt.want):
+				t.Fatalf("compareHeaders error = %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplateMatcher(t *testing.T) {
+	state := newTemplateState("run1", 3, 7)
+	state.seq = 12
+	for _, template := range []string{
+		"{{run_id}}-{{client_id}}-{{seq}}",
+		"id={{uuid}}",
+		"at {{now}}",
+		"{{rand_int -5 5}}",
+		"{{rand_int 5}} and {{unknown}}",
+		"a.b*c {{ run_id }}",
+	} {
+		expanded := expandTemplate(template, state)
+		if !templateMatcher(template, "run1").MatchString(expanded) {
+			t.Errorf("templateMatcher(%q) does not match %q", template, expanded)
+		}
+		if templateMatcher(template, "run1").MatchString(expanded + "x") {
+			t.Errorf("templateMatcher(%q) matches a trailing suffix", template)
+		}
+	}
+}
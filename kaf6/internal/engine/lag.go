@@ -0,0 +1,194 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package engine
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"kaf6/internal/metrics"
+	"kaf6/internal/scenario"
+)
+
+type LagSample struct {
+	At  time.Duration
+	Lag int64
+}
+
+type LagResult struct {
+	Interval    time.Duration
+	Samples     []LagSample
+	Max         int64
+	Drained     bool
+	TimeToDrain time.Duration
+}
+
+// lagSampler lists the high-water marks every interval and compares them
+// with how far the consumers have read. It starts with the producer so the
+// series shows the backlog building up; until the consumer attaches, the
+// read position is the end of the topic when sampling began.
+type lagSampler struct {
+	admin    *kadm.Client
+	client   *kgo.Client
+	topic    string
+	produced *produceLog
+	sum      *metrics.Summary
+	begin    time.Time
+	stop     context.CancelFunc
+	done     chan struct{}
+	closed   sync.Once
+
+	mu       sync.Mutex
+	out      *LagResult
+	baseline map[int32]int64
+	position func() map[int32]int64
+	backlog  bool
+}
+
+// lagInterval returns the consumer's lag sampling interval, 1s by default.
+func lagInterval(cfg *scenario.ConsumerScenario) time.Duration {
+	if cfg.LagInterval != "" {
+		if parsed, err := time.ParseDuration(cfg.LagInterval); err == nil && parsed > 0 {
+			return parsed
+		}
+	}
+	return 1 * time.Second
+}
+
+// startLag starts sampling lag on topic. Sampling stops when ctx is done or
+// the sampler is finished; one last sample is taken then so the series ends
+// with the final lag.
+func startLag(ctx context.Context, brokers []string, topic string, interval time.Duration, produced *produceLog, sum *metrics.Summary) *lagSampler {
+	ctx, stop := context.WithCancel(ctx)
+	s := &lagSampler{
+		topic:    topic,
+		produced: produced,
+		sum:      sum,
+		begin:    time.Now(),
+		stop:     stop,
+		done:     make(chan struct{}),
+		out:      &LagResult{Interval: interval},
+	}
+	client, err := kgo.NewClient(kgo.SeedBrokers(brokers...))
+	if err != nil {
+		close(s.done)
+		return s
+	}
+	s.client = client
+	s.admin = kadm.NewClient(client)
+	if ends, err := s.admin.ListEndOffsets(ctx, topic); err == nil && ends.Error() == nil {
+		s.baseline = make(map[int32]int64)
+		ends.Each(func(end kadm.ListedOffset) {
+			s.baseline[end.Partition] = end.Offset
+		})
+	}
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		s.sample(ctx)
+		for {
+			select {
+			case <-ctx.Done():
+				final, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				s.sample(final)
+				cancel()
+				return
+			case <-ticker.C:
+				s.sample(ctx)
+			}
+		}
+	}()
+	return s
+}
+
+// attach switches the read position to the consumer's and samples right
+// away, so the backlog the consumer starts with is in the series even when
+// it drains before the next tick. position reports the next offset to read
+// per partition.
+func (s *lagSampler) attach(ctx context.Context, position func() map[int32]int64) {
+	s.mu.Lock()
+	s.position = position
+	s.mu.Unlock()
+	s.sample(ctx)
+}
+
+// finish stops sampling and returns the series. It is safe to call more
+// than once.
+func (s *lagSampler) finish() *LagResult {
+	s.stop()
+	<-s.done
+	s.closed.Do(func() {
+		if s.client != nil {
+			s.client.Close()
+		}
+	})
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.out
+}
+
+// sample lists the high-water marks and records the lag against the
+// current read position.
+func (s *lagSampler) sample(ctx context.Context) {
+	if s.admin == nil {
+		return
+	}
+	ends, err := s.admin.ListEndOffsets(ctx, s.topic)
+	if err != nil || ends.Error() != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	positions := s.baseline
+	if s.position != nil {
+		positions = s.position()
+	}
+	var lag int64
+	ends.Each(func(end kadm.ListedOffset) {
+		if behind := end.Offset - positions[end.Partition]; behind > 0 {
+			lag += behind
+		}
+	})
+	s.record(lag, time.Now())
+}
+
+// record adds a sample; s.mu must be held. The run counts as drained at the
+// first zero-lag sample after the consumer attached, saw a backlog and the
+// producer step ended; time to drain runs from the last acknowledgement.
+// Without a backlog, as when reading from latest, nothing was drained.
+func (s *lagSampler) record(lag int64, now time.Time) {
+	s.out.Samples = append(s.out.Samples, LagSample{At: now.Sub(s.begin), Lag: lag})
+	s.out.Max = max(s.out.Max, lag)
+	s.sum.ObserveLag(lag)
+	if s.position == nil || s.out.Drained {
+		return
+	}
+	if lag > 0 {
+		s.backlog = true
+		return
+	}
+	if drainStart := s.produced.drainStart(); s.backlog && !drainStart.IsZero() {
+		s.out.Drained = true
+		s.out.TimeToDrain = max(now.Sub(drainStart), 0)
+	}
+}
@@ -0,0 +1,103 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"kaf6/internal/metrics"
+)
+
+func TestLagSamplerDrain(t *testing.T) {
+	position := func() map[int32]int64 { return nil }
+	type step struct {
+		attach bool
+		ack    bool
+		finish bool
+		lag    int64
+	}
+	cases := []struct {
+		name    string
+		steps   []step
+		drained bool
+	}{
+		{
+			name:    "drains after the producer ends",
+			steps:   []step{{lag: 5, ack: true}, {attach: true, lag: 5, finish: true}, {lag: 2}, {lag: 0}},
+			drained: true,
+		},
+		{
+			name:  "latest start never sees a backlog",
+			steps: []step{{lag: 5, ack: true, finish: true}, {attach: true, lag: 0}, {lag: 0}},
+		},
+		{
+			name:  "caught up while the producer still runs",
+			steps: []step{{attach: true, lag: 3, ack: true}, {lag: 0}},
+		},
+		{
+			name:  "search probe without a producer end",
+			steps: []step{{attach: true, lag: 3, ack: true}, {lag: 0}, {lag: 4, ack: true}, {lag: 0}},
+		},
+		{
+			name:  "zero lag before the consumer attached",
+			steps: []step{{lag: 3, ack: true, finish: true}, {lag: 0}},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			produced := &produceLog{start: time.Now()}
+			s := &lagSampler{produced: produced, sum: &metrics.Summary{}, begin: time.Now(), out: &LagResult{}}
+			for _, step := range tc.steps {
+				if step.ack {
+					produced.mu.Lock()
+					produced.lastAck = time.Now()
+					produced.mu.Unlock()
+				}
+				if step.finish {
+					produced.finish()
+				}
+				if step.attach {
+					s.position = position
+				}
+				s.record(step.lag, time.Now())
+			}
+			if s.out.Drained != tc.drained {
+				t.Fatalf("drained = %v, want %v", s.out.Drained, tc.drained)
+			}
+			if len(s.out.Samples) != len(tc.steps) {
+				t.Fatalf("samples = %d, want %d", len(s.out.Samples), len(tc.steps))
+			}
+		})
+	}
+}
+
+func TestProduceLogDrainStart(t *testing.T) {
+	produced := &produceLog{start: time.Now()}
+	if !produced.drainStart().IsZero() {
+		t.Fatal("drain start set while producing")
+	}
+	produced.mu.Lock()
+	ack := time.Now().Add(-time.Second)
+	produced.lastAck = ack
+	produced.mu.Unlock()
+	produced.finish()
+	if got := produced.drainStart(); !got.Equal(ack) {
+		t.Fatalf("drain start = %v, want last ack %v", got, ack)
+	}
+}
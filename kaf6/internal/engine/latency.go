@@ -0,0 +1,90 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package engine
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"kaf6/internal/metrics"
+)
+
+// ClockSkew lists a producer whose records were consumed before the send time
+// they carry, which can only happen when the producer clock is ahead of the
+// consumer clock. MaxAhead is the largest such difference.
+type ClockSkew struct {
+	Producer string
+	Records  int64
+	MaxAhead time.Duration
+}
+
+type skewLog struct {
+	mu         sync.Mutex
+	byProducer map[string]*ClockSkew
+}
+
+func (l *skewLog) observe(producer string, ahead time.Duration) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.byProducer == nil {
+		l.byProducer = make(map[string]*ClockSkew)
+	}
+	entry, ok := l.byProducer[producer]
+	if !ok {
+		entry = &ClockSkew{Producer: producer}
+		l.byProducer[producer] = entry
+	}
+	entry.Records++
+	entry.MaxAhead = max(entry.MaxAhead, ahead)
+}
+
+func (l *skewLog) results() []ClockSkew {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := make([]ClockSkew, 0, len(l.byProducer))
+	for _, entry := range l.byProducer {
+		out = append(out, *entry)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Producer < out[j].Producer })
+	return out
+}
+
+// observeConsumed records the latencies of a consumed record. The record
+// timestamp age is always recorded; records stamped by a kaf6 producer also
+// give the end-to-end latency from their send time and the broker timestamp
+// delta, which is the record timestamp minus the send time.
+func observeConsumed(sum *metrics.Summary, skew *skewLog, record *kgo.Record) {
+	now := time.Now()
+	sum.AddConsume(now.Sub(record.Timestamp))
+	sentAt, producer, ok := sendTime(record)
+	if !ok {
+		return
+	}
+	endToEnd := now.Sub(sentAt)
+	sum.AddEndToEnd(endToEnd)
+	sum.AddBrokerDelta(record.Timestamp.Sub(sentAt))
+	if endToEnd < 0 {
+		skew.observe(producer, -endToEnd)
+	}
+}
@@ -0,0 +1,85 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package engine
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"kaf6/internal/metrics"
+)
+
+func stamped(sentAt time.Time, producer string) *kgo.Record {
+	return &kgo.Record{
+		Timestamp: sentAt.Add(5 * time.Millisecond),
+		Headers: []kgo.RecordHeader{
+			{Key: sentAtHeader, Value: []byte(strconv.FormatInt(sentAt.UnixNano(), 10))},
+			{Key: producerHeader, Value: []byte(producer)},
+		},
+	}
+}
+
+func TestSendTime(t *testing.T) {
+	sentAt := time.Unix(0, 1700000000123456789)
+	got, producer, ok := sendTime(stamped(sentAt, "p1"))
+	if !ok || !got.Equal(sentAt) || producer != "p1" {
+		t.Fatalf("got %v %q %t, want %v p1 true", got, producer, ok, sentAt)
+	}
+	if _, _, ok := sendTime(&kgo.Record{}); ok {
+		t.Fatal("record without headers has a send time")
+	}
+	bad := &kgo.Record{Headers: []kgo.RecordHeader{{Key: sentAtHeader, Value: []byte("soon")}}}
+	if _, _, ok := sendTime(bad); ok {
+		t.Fatal("malformed send time accepted")
+	}
+}
+
+func TestObserveConsumed(t *testing.T) {
+	sum := &metrics.Summary{}
+	skew := &skewLog{}
+	observeConsumed(sum, skew, &kgo.Record{Timestamp: time.Now()})
+	observeConsumed(sum, skew, stamped(time.Now().Add(-time.Second), "behind"))
+	observeConsumed(sum, skew, stamped(time.Now().Add(time.Minute), "ahead"))
+	observeConsumed(sum, skew, stamped(time.Now().Add(2*time.Minute), "ahead"))
+	observeConsumed(sum, nil, stamped(time.Now().Add(time.Minute), "unlogged"))
+
+	if sum.Consumed != 5 {
+		t.Fatalf("got %d consumed, want 5", sum.Consumed)
+	}
+	if len(sum.EndToEndLatencies) != 1 || sum.ClockSkew != 3 {
+		t.Fatalf("got %d end-to-end latencies and %d clock skewed, want 1 and 3", len(sum.EndToEndLatencies), sum.ClockSkew)
+	}
+	if len(sum.BrokerDeltas) != 4 {
+		t.Fatalf("got %d broker deltas, want 4", len(sum.BrokerDeltas))
+	}
+	for _, delta := range sum.BrokerDeltas {
+		if delta != 5*time.Millisecond {
+			t.Fatalf("got broker delta %v, want 5ms", delta)
+		}
+	}
+	skews := skew.results()
+	if len(skews) != 1 || skews[0].Producer != "ahead" || skews[0].Records != 2 {
+		t.Fatalf("got clock skew %+v, want two records from ahead", skews)
+	}
+	if skews[0].MaxAhead < 119*time.Second || skews[0].MaxAhead > 2*time.Minute {
+		t.Fatalf("got max ahead %v, want about 2m", skews[0].MaxAhead)
+	}
+}
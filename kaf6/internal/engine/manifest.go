@@ -0,0 +1,323 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package engine
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"kaf6/internal/scenario"
+)
+
+// maxDurabilityProblems caps how many individual records the report lists;
+// the counters always cover every record.
+const maxDurabilityProblems = 100
+
+// defaultVerifyTimeout bounds the verify read when --verify-timeout is unset.
+const defaultVerifyTimeout = 2 * time.Minute
+
+// verifyPollTimeout is how long one poll of the verify read waits, so the
+// read notices the deadline while partitions are quiet.
+const verifyPollTimeout = 1 * time.Second
+
+// Manifest is written by the produce phase and lists every acknowledged record
+// so the verify phase can reconcile the topic against it later, in another
+// process and after the cluster was restarted.
+type Manifest struct {
+	RunID      string
+	Scenario   string
+	Topic      string
+	Brokers    []string
+	ProducedAt time.Time
+	Records    []ManifestRecord
+}
+
+type ManifestRecord struct {
+	ID        string
+	Partition int32
+	Offset    int64
+	Hash      string
+}
+
+// DurabilityResult is the verify phase reconciliation. Found records match
+// the manifest at their offset; corrupted ones carry the right ID with a
+// different value; moved ones were found at another offset. Unread ones lie
+// past where the read stopped when the verify timeout ran out, so whether
+// they survived is unknown.
+type DurabilityResult struct {
+	Manifest      string
+	ProducedRunID string
+	Topic         string
+	Expected      int64
+	Found         int64
+	Missing       int64
+	Corrupted     int64
+	Moved         int64
+	Unread        int64
+	Problems      []DurabilityProblem
+	Status        string
+}
+
+type DurabilityProblem struct {
+	ID        string
+	Partition int32
+	Offset    int64
+	Kind      string
+	Detail    string
+}
+
+func WriteManifest(path string, manifest *Manifest) error {
+	payload, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, payload, 0o644)
+}
+
+func ReadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("parse manifest %s: %w", path, err)
+	}
+	if manifest.Topic == "" {
+		return nil, fmt.Errorf("manifest %s has no topic", path)
+	}
+	return &manifest, nil
+}
+
+func valueHash(value []byte) string {
+	sum := sha256.Sum256(value)
+	return hex.EncodeToString(sum[:8])
+}
+
+func recordID(record *kgo.Record) string {
+	for _, header := range record.Headers {
+		if header.Key == recordIDHeader {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+type storedRecord struct {
+	id   string
+	hash string
+}
+
+// manifestRead is what the verify phase read back: the records per partition
+// and offset, where each ID was found, the offset after the last record read
+// per partition and the log end offsets when the read began.
+type manifestRead struct {
+	byOffset map[int32]map[int64]storedRecord
+	byID     map[string]ManifestRecord
+	next     map[int32]int64
+	ends     map[int32]int64
+}
+
+func (r *manifestRead) add(record *kgo.Record) {
+	if r.byOffset[record.Partition] == nil {
+		r.byOffset[record.Partition] = make(map[int64]storedRecord)
+	}
+	id := recordID(record)
+	r.byOffset[record.Partition][record.Offset] = storedRecord{id: id, hash: valueHash(record.Value)}
+	if id != "" {
+		r.byID[id] = ManifestRecord{ID: id, Partition: record.Partition, Offset: record.Offset}
+	}
+	r.next[record.Partition] = max(r.next[record.Partition], record.Offset+1)
+}
+
+// manifestTargets returns the manifest's high-water mark per partition: the
+// offset after the last record it lists.
+func manifestTargets(manifest *Manifest) map[int32]int64 {
+	targets := make(map[int32]int64)
+	for _, record := range manifest.Records {
+		targets[record.Partition] = max(targets[record.Partition], record.Offset+1)
+	}
+	return targets
+}
+
+// verifyManifest reads every manifest partition from the start until it
+// reaches the manifest's high-water mark, or the log end if that is lower,
+// then reconciles the records. A compacted tail never reaches the mark, so
+// the read also ends when the verify timeout runs out; records past where
+// it stopped are reported as unread rather than missing.
+func verifyManifest(ctx context.Context, spec *scenario.ScenarioFile, manifest *Manifest, path string, verbose bool) (*DurabilityResult, error) {
+	out := &DurabilityResult{
+		Manifest:      path,
+		ProducedRunID: manifest.RunID,
+		Topic:         manifest.Topic,
+		Expected:      int64(len(manifest.Records)),
+	}
+	timeout := spec.VerifyTimeout
+	if timeout <= 0 {
+		timeout = defaultVerifyTimeout
+	}
+	admin, err := kgo.NewClient(kgo.SeedBrokers(spec.Brokers...))
+	if err != nil {
+		return nil, err
+	}
+	adm := kadm.NewClient(admin)
+	starts, err := adm.ListStartOffsets(ctx, manifest.Topic)
+	if err == nil {
+		err = starts.Error()
+	}
+	if err != nil {
+		admin.Close()
+		return nil, fmt.Errorf("list start offsets: %w", err)
+	}
+	ends, err := adm.ListEndOffsets(ctx, manifest.Topic)
+	admin.Close()
+	if err == nil {
+		err = ends.Error()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("list end offsets: %w", err)
+	}
+
+	read := &manifestRead{
+		byOffset: make(map[int32]map[int64]storedRecord),
+		byID:     make(map[string]ManifestRecord),
+		next:     make(map[int32]int64),
+		ends:     make(map[int32]int64),
+	}
+	targets := manifestTargets(manifest)
+	assign := make(map[int32]kgo.Offset)
+	ends.Each(func(end kadm.ListedOffset) {
+		read.ends[end.Partition] = end.Offset
+		start, _ := starts.Lookup(manifest.Topic, end.Partition)
+		read.next[end.Partition] = start.Offset
+		// The whole topic is read so moved records are found anywhere;
+		// partitions the manifest does not use are read to their end.
+		target, ok := targets[end.Partition]
+		if !ok || target > end.Offset {
+			target = end.Offset
+		}
+		if target > start.Offset {
+			targets[end.Partition] = target
+			assign[end.Partition] = kgo.NewOffset().AtStart()
+		} else {
+			delete(targets, end.Partition)
+		}
+	})
+	for partition := range targets {
+		if _, ok := read.ends[partition]; !ok {
+			delete(targets, partition)
+		}
+	}
+
+	if len(assign) > 0 {
+		client, err := kgo.NewClient(
+			kgo.SeedBrokers(spec.Brokers...),
+			kgo.ConsumePartitions(map[string]map[int32]kgo.Offset{manifest.Topic: assign}),
+		)
+		if err != nil {
+			return nil, err
+		}
+		defer client.Close()
+		readCtx, cancelRead := context.WithTimeout(ctx, timeout)
+		defer cancelRead()
+		for len(targets) > 0 && readCtx.Err() == nil {
+			pollCtx, cancelPoll := context.WithTimeout(readCtx, verifyPollTimeout)
+			fetches := client.PollFetches(pollCtx)
+			cancelPoll()
+			if ctx.Err() != nil {
+				return nil, fmt.Errorf("verify read stopped with %d partitions unread: %w", len(targets), ctx.Err())
+			}
+			if pollCtx.Err() != nil {
+				continue
+			}
+			if errs := fetches.Errors(); len(errs) > 0 {
+				return nil, fmt.Errorf("fetch errors: %+v", errs)
+			}
+			fetches.EachRecord(func(record *kgo.Record) {
+				read.add(record)
+				if target, ok := targets[record.Partition]; ok && record.Offset+1 >= target {
+					delete(targets, record.Partition)
+				}
+			})
+		}
+		if len(targets) > 0 && verbose {
+			fmt.Printf("verify: read timed out after %s with %d partitions short of the manifest\n", timeout, len(targets))
+		}
+	}
+
+	reconcileManifest(out, manifest, read)
+	if verbose {
+		fmt.Printf("verify: expected=%d found=%d missing=%d corrupted=%d moved=%d unread=%d\n", out.Expected, out.Found, out.Missing, out.Corrupted, out.Moved, out.Unread)
+	}
+	return out, nil
+}
+
+// reconcileManifest classifies every manifest record against what was read.
+// A record that is neither at its offset nor anywhere else is missing when
+// the read covered its offset or the log now ends before it, and unread
+// when the read stopped short of it.
+func reconcileManifest(out *DurabilityResult, manifest *Manifest, read *manifestRead) {
+	problem := func(record ManifestRecord, kind string, detail string) {
+		if len(out.Problems) < maxDurabilityProblems {
+			out.Problems = append(out.Problems, DurabilityProblem{ID: record.ID, Partition: record.Partition, Offset: record.Offset, Kind: kind, Detail: detail})
+		}
+	}
+	for _, record := range manifest.Records {
+		got, ok := read.byOffset[record.Partition][record.Offset]
+		switch {
+		case ok && got.id == record.ID && got.hash == record.Hash:
+			out.Found++
+		case ok && got.id == record.ID:
+			out.Corrupted++
+			problem(record, "corrupted", fmt.Sprintf("value hash %s, manifest %s", got.hash, record.Hash))
+		default:
+			if moved, ok := read.byID[record.ID]; ok {
+				out.Moved++
+				problem(record, "moved", fmt.Sprintf("found at partition %d offset %d", moved.Partition, moved.Offset))
+				continue
+			}
+			end, listed := read.ends[record.Partition]
+			if next := read.next[record.Partition]; listed && record.Offset < end && record.Offset >= next {
+				out.Unread++
+				problem(record, "unread", fmt.Sprintf("read stopped at offset %d", next))
+				continue
+			}
+			out.Missing++
+			problem(record, "missing", "")
+		}
+	}
+	sort.Slice(out.Problems, func(i, j int) bool {
+		if out.Problems[i].Partition != out.Problems[j].Partition {
+			return out.Problems[i].Partition < out.Problems[j].Partition
+		}
+		return out.Problems[i].Offset < out.Problems[j].Offset
+	})
+	out.Status = "pass"
+	if out.Missing > 0 || out.Corrupted > 0 || out.Moved > 0 || out.Unread > 0 {
+		out.Status = "fail"
+	}
+}
@@ -0,0 +1,91 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package engine
+
+import (
+	"testing"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func TestReconcileManifest(t *testing.T) {
+	record := func(id string, partition int32, offset int64, value string) *kgo.Record {
+		return &kgo.Record{
+			Partition: partition,
+			Offset:    offset,
+			Value:     []byte(value),
+			Headers:   []kgo.RecordHeader{{Key: recordIDHeader, Value: []byte(id)}},
+		}
+	}
+	manifest := &Manifest{Records: []ManifestRecord{
+		{ID: "found", Partition: 0, Offset: 0, Hash: valueHash([]byte("a"))},
+		{ID: "corrupted", Partition: 0, Offset: 1, Hash: valueHash([]byte("b"))},
+		{ID: "moved", Partition: 0, Offset: 2, Hash: valueHash([]byte("c"))},
+		{ID: "missing", Partition: 0, Offset: 3, Hash: valueHash([]byte("d"))},
+		{ID: "found-late", Partition: 0, Offset: 4, Hash: valueHash([]byte("e"))},
+		{ID: "unread", Partition: 1, Offset: 5, Hash: valueHash([]byte("f"))},
+		{ID: "truncated", Partition: 1, Offset: 9, Hash: valueHash([]byte("g"))},
+		{ID: "retention", Partition: 2, Offset: 0, Hash: valueHash([]byte("h"))},
+	}}
+	read := &manifestRead{
+		byOffset: make(map[int32]map[int64]storedRecord),
+		byID:     make(map[string]ManifestRecord),
+		next:     map[int32]int64{0: 0, 1: 0, 2: 4},
+		ends:     map[int32]int64{0: 5, 1: 8, 2: 4},
+	}
+	for _, r := range []*kgo.Record{
+		record("found", 0, 0, "a"),
+		record("corrupted", 0, 1, "x"),
+		record("found-late", 0, 4, "e"),
+		record("moved", 1, 0, "c"),
+		record("other", 1, 1, "z"),
+	} {
+		read.add(r)
+	}
+
+	out := &DurabilityResult{Expected: int64(len(manifest.Records))}
+	reconcileManifest(out, manifest, read)
+	if out.Found != 2 || out.Corrupted != 1 || out.Moved != 1 || out.Missing != 3 || out.Unread != 1 {
+		t.Fatalf("found=%d corrupted=%d moved=%d missing=%d unread=%d", out.Found, out.Corrupted, out.Moved, out.Missing, out.Unread)
+	}
+	if out.Status != "fail" {
+		t.Fatalf("status = %s, want fail", out.Status)
+	}
+	kinds := make(map[string]string)
+	for _, problem := range out.Problems {
+		kinds[problem.ID] = problem.Kind
+	}
+	want := map[string]string{"corrupted": "corrupted", "moved": "moved", "missing": "missing", "unread": "unread", "truncated": "missing", "retention": "missing"}
+	for id, kind := range want {
+		if kinds[id] != kind {
+			t.Errorf("%s: kind %q, want %q", id, kinds[id], kind)
+		}
+	}
+}
+
+func TestManifestTargets(t *testing.T) {
+	manifest := &Manifest{Records: []ManifestRecord{
+		{Partition: 0, Offset: 4},
+		{Partition: 0, Offset: 2},
+		{Partition: 2, Offset: 0},
+	}}
+	targets := manifestTargets(manifest)
+	if len(targets) != 2 || targets[0] != 5 || targets[2] != 1 {
+		t.Fatalf("targets = %v", targets)
+	}
+}
@@ -0,0 +1,207 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+type PartitionOffset struct {
+	Partition int32
+	Offset    int64
+}
+
+// firstFetched remembers the lowest offset fetched per partition. In a
+// consumer group that is where the reset offset or a committed offset
+// actually put the consumer, which the offsets resolved before the join
+// cannot tell.
+type firstFetched struct {
+	mu      sync.Mutex
+	offsets map[int32]int64
+}
+
+func (f *firstFetched) observe(partition int32, offset int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if first, ok := f.offsets[partition]; !ok || offset < first {
+		f.offsets[partition] = offset
+	}
+}
+
+func (f *firstFetched) sorted() []PartitionOffset {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := make([]PartitionOffset, 0, len(f.offsets))
+	for partition, offset := range f.offsets {
+		out = append(out, PartitionOffset{Partition: partition, Offset: offset})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Partition < out[j].Partition })
+	return out
+}
+
+// startOffset is a parsed ConsumerScenario.Offset. at holds the absolute
+// offset, the distance from the end, or the timestamp in milliseconds,
+// depending on kind.
+type startOffset struct {
+	kind string
+	at   int64
+}
+
+func parseStartOffset(input string, produceStart time.Time) (startOffset, error) {
+	switch {
+	case input == "" || input == "earliest":
+		return startOffset{kind: "earliest"}, nil
+	case input == "latest":
+		return startOffset{kind: "latest"}, nil
+	case input == "after_produce_start":
+		return startOffset{kind: "timestamp", at: produceStart.UnixMilli()}, nil
+	case strings.HasPrefix(input, "offset:"):
+		n, err := strconv.ParseInt(strings.TrimPrefix(input, "offset:"), 10, 64)
+		if err != nil || n < 0 {
+			return startOffset{}, fmt.Errorf("invalid consumer offset: %s", input)
+		}
+		return startOffset{kind: "offset", at: n}, nil
+	case strings.HasPrefix(input, "end-"):
+		n, err := strconv.ParseInt(strings.TrimPrefix(input, "end-"), 10, 64)
+		if err != nil || n < 0 {
+			return startOffset{}, fmt.Errorf("invalid consumer offset: %s", input)
+		}
+		return startOffset{kind: "end", at: n}, nil
+	case strings.HasPrefix(input, "timestamp:"):
+		ts, err := time.Parse(time.RFC3339Nano, strings.TrimPrefix(input, "timestamp:"))
+		if err != nil {
+			return startOffset{}, fmt.Errorf("invalid consumer offset: %s", input)
+		}
+		return startOffset{kind: "timestamp", at: ts.UnixMilli()}, nil
+	default:
+		return startOffset{}, fmt.Errorf("unknown consumer offset: %s", input)
+	}
+}
+
+// kgoOffset is the reset offset a consumer group uses for partitions without
+// a committed offset.
+func (s startOffset) kgoOffset() kgo.Offset {
+	switch s.kind {
+	case "latest":
+		return kgo.NewOffset().AtEnd()
+	case "offset":
+		return kgo.NewOffset().At(s.at)
+	case "end":
+		return kgo.NewOffset().AtEnd().Relative(-s.at)
+	case "timestamp":
+		return kgo.NewOffset().AfterMilli(s.at)
+	default:
+		return kgo.NewOffset().AtStart()
+	}
+}
+
+// listEndOffsets returns the current end offset of every partition of topic.
+func listEndOffsets(ctx context.Context, brokers []string, topic string) (map[int32]int64, error) {
+	client, err := kgo.NewClient(kgo.SeedBrokers(brokers...))
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	ends, err := kadm.NewClient(client).ListEndOffsets(ctx, topic)
+	if err == nil {
+		err = ends.Error()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("list end offsets: %w", err)
+	}
+	out := make(map[int32]int64)
+	ends.Each(func(end kadm.ListedOffset) {
+		out[end.Partition] = end.Offset
+	})
+	return out, nil
+}
+
+// resolve asks the brokers where the start offset lands in each partition.
+// Absolute and relative offsets are clamped to the log start and end, as the
+// broker would when the consumer fetches out of range. The end offsets are
+// returned as well.
+func (s startOffset) resolve(ctx context.Context, brokers []string, topic string) ([]PartitionOffset, []PartitionOffset, error) {
+	client, err := kgo.NewClient(kgo.SeedBrokers(brokers...))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer client.Close()
+	admin := kadm.NewClient(client)
+	starts, err := admin.ListStartOffsets(ctx, topic)
+	if err == nil {
+		err = starts.Error()
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("list start offsets: %w", err)
+	}
+	ends, err := admin.ListEndOffsets(ctx, topic)
+	if err == nil {
+		err = ends.Error()
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("list end offsets: %w", err)
+	}
+	var times kadm.ListedOffsets
+	if s.kind == "timestamp" {
+		times, err = admin.ListOffsetsAfterMilli(ctx, s.at, topic)
+		if err == nil {
+			err = times.Error()
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("list offsets after %d: %w", s.at, err)
+		}
+	}
+
+	var out, tails []PartitionOffset
+	for partition, start := range starts[topic] {
+		end, ok := ends.Lookup(topic, partition)
+		if !ok {
+			return nil, nil, fmt.Errorf("no end offset for partition %d", partition)
+		}
+		offset := start.Offset
+		switch s.kind {
+		case "latest":
+			offset = end.Offset
+		case "offset":
+			offset = s.at
+		case "end":
+			offset = end.Offset - s.at
+		case "timestamp":
+			if listed, ok := times.Lookup(topic, partition); ok && listed.Offset >= 0 {
+				offset = listed.Offset
+			} else {
+				offset = end.Offset
+			}
+		}
+		offset = max(start.Offset, min(offset, end.Offset))
+		out = append(out, PartitionOffset{Partition: partition, Offset: offset})
+		tails = append(tails, PartitionOffset{Partition: partition, Offset: end.Offset})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Partition < out[j].Partition })
+	sort.Slice(tails, func(i, j int) bool { return tails[i].Partition < tails[j].Partition })
+	return out, tails, nil
+}
@@ -0,0 +1,48 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package engine
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestFirstFetchedKeepsLowestOffset(t *testing.T) {
+	first := &firstFetched{offsets: make(map[int32]int64)}
+	// Two clients share partition 1 across a rebalance; the one that took
+	// it over resumes from a committed offset above the first fetch.
+	var wg sync.WaitGroup
+	for _, fetch := range [][]PartitionOffset{
+		{{Partition: 1, Offset: 40}, {Partition: 1, Offset: 41}, {Partition: 0, Offset: 7}},
+		{{Partition: 1, Offset: 55}, {Partition: 2, Offset: 3}},
+	} {
+		wg.Add(1)
+		go func(fetch []PartitionOffset) {
+			defer wg.Done()
+			for _, record := range fetch {
+				first.observe(record.Partition, record.Offset)
+			}
+		}(fetch)
+	}
+	wg.Wait()
+	want := []PartitionOffset{{Partition: 0, Offset: 7}, {Partition: 1, Offset: 40}, {Partition: 2, Offset: 3}}
+	if got := first.sorted(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("first fetched = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,406 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package engine
+
+import (
+	"context"
+	cryptorand "crypto/rand"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"kaf6/internal/scenario"
+)
+
+const alphanumeric = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+var templatePattern = regexp.MustCompile(`\{\{\s*([a-z_]+)((?:\s+[^\s}]+)*)\s*\}\}`)
+
+// templateState carries the per-client values used to expand templates. Each
+// producer client owns one, so expansion needs no locking and a seeded run
+// yields the same sequence of values.
+type templateState struct {
+	runID    string
+	clientID int
+	seq      int64
+	rng      *rand.Rand
+}
+
+func newTemplateState(runID string, clientID int, seed int64) *templateState {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &templateState{
+		runID:    runID,
+		clientID: clientID,
+		rng:      rand.New(rand.NewSource(seed + int64(clientID))),
+	}
+}
+
+func expandTemplate(input string, state *templateState) string {
+	if !strings.Contains(input, "{{") {
+		return input
+	}
+	return templatePattern.ReplaceAllStringFunc(input, func(match string) string {
+		parts := templatePattern.FindStringSubmatch(match)
+		args := strings.Fields(parts[2])
+		switch parts[1] {
+		case "run_id":
+			return state.runID
+		case "uuid":
+			return randomUUID()
+		case "now":
+			return time.Now().UTC().Format(time.RFC3339Nano)
+		case "seq":
+			return strconv.FormatInt(state.seq, 10)
+		case "client_id":
+			return strconv.Itoa(state.clientID)
+		case "rand_int":
+			low, high, ok := randIntRange(args)
+			if !ok {
+				return match
+			}
+			return strconv.Itoa(low + state.rng.Intn(high-low+1))
+		case "env":
+			if len(args) != 1 {
+				return match
+			}
+			return os.Getenv(args[0])
+		default:
+			return match
+		}
+	})
+}
+
+// templateMatcher turns a template into a pattern for its expansions. The
+// run ID and environment variables are the same for every record and must
+// match exactly; values that change per record match anything of their shape.
+func templateMatcher(input string, runID string) *regexp.Regexp {
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	last := 0
+	for _, loc := range templatePattern.FindAllStringSubmatchIndex(input, -1) {
+		pattern.WriteString(regexp.QuoteMeta(input[last:loc[0]]))
+		last = loc[1]
+		match := input[loc[0]:loc[1]]
+		args := strings.Fields(input[loc[4]:loc[5]])
+		switch input[loc[2]:loc[3]] {
+		case "run_id":
+			pattern.WriteString(regexp.QuoteMeta(runID))
+		case "uuid":
+			pattern.WriteString(`[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}`)
+		case "now":
+			pattern.WriteString(`\d{4}-\d{2}-\d{2}T[0-9:.]+Z`)
+		case "seq", "client_id":
+			pattern.WriteString(`\d+`)
+		case "rand_int":
+			if _, _, ok := randIntRange(args); ok {
+				pattern.WriteString(`-?\d+`)
+			} else {
+				pattern.WriteString(regexp.QuoteMeta(match))
+			}
+		case "env":
+			if len(args) == 1 {
+				pattern.WriteString(regexp.QuoteMeta(os.Getenv(args[0])))
+			} else {
+				pattern.WriteString(regexp.QuoteMeta(match))
+			}
+		default:
+			pattern.WriteString(regexp.QuoteMeta(match))
+		}
+	}
+	pattern.WriteString(regexp.QuoteMeta(input[last:]))
+	pattern.WriteString("$")
+	return regexp.MustCompile(pattern.String())
+}
+
+// randIntRange parses the bounds of {{rand_int low high}}.
+func randIntRange(args []string) (int, int, bool) {
+	if len(args) != 2 {
+		return 0, 0, false
+	}
+	low, errLow := strconv.Atoi(args[0])
+	high, errHigh := strconv.Atoi(args[1])
+	if errLow != nil || errHigh != nil || high < low {
+		return 0, 0, false
+	}
+	return low, high, true
+}
+
+// randomUUID returns a version 4 UUID from crypto/rand. It does not follow the
+// run seed: a seeded run repeats its other values, but its UUIDs must still
+// differ from every earlier run's.
+func randomUUID() string {
+	var b [16]byte
+	cryptorand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+type payloadGenerator struct {
+	mode     string
+	schema   *schemaCodec
+	corpus   *corpus
+	original bool
+	json     map[string]string
+	nested   any
+	template string
+	minSize  int
+	maxSize  int
+	ratio    float64
+}
+
+func newPayloadGenerator(spec scenario.PayloadSpec) (*payloadGenerator, error) {
+	gen := &payloadGenerator{
+		mode:     spec.Mode,
+		json:     spec.JSON,
+		nested:   spec.Nested,
+		template: spec.Template,
+		ratio:    spec.Ratio,
+		original: spec.OriginalTimestamps,
+	}
+	if gen.mode == "" && spec.Schema != nil {
+		gen.mode = "schema"
+	}
+	if gen.mode == "" && spec.File != "" {
+		gen.mode = "file"
+	}
+	if gen.mode == "" {
+		gen.mode = "json"
+	}
+	var err error
+	if spec.Size != "" {
+		if gen.minSize, err = parseSize(spec.Size); err != nil {
+			return nil, err
+		}
+		gen.maxSize = gen.minSize
+	}
+	if spec.MinSize != "" {
+		if gen.minSize, err = parseSize(spec.MinSize); err != nil {
+			return nil, err
+		}
+	}
+	if spec.MaxSize != "" {
+		if gen.maxSize, err = parseSize(spec.MaxSize); err != nil {
+			return nil, err
+		}
+	}
+	if gen.maxSize < gen.minSize {
+		gen.maxSize = gen.minSize
+	}
+	switch gen.mode {
+	case "json", "nested", "template":
+	case "schema":
+		if spec.Schema == nil {
+			return nil, fmt.Errorf("payload mode schema requires a schema")
+		}
+	case "file":
+		if spec.File == "" {
+			return nil, fmt.Errorf("payload mode file requires a file")
+		}
+	case "fixed", "random", "binary", "compressible":
+		if gen.maxSize <= 0 {
+			return nil, fmt.Errorf("payload mode %s requires size or min_size/max_size", gen.mode)
+		}
+		if gen.mode == "fixed" && gen.minSize != gen.maxSize {
+			return nil, fmt.Errorf("payload mode fixed requires a single size")
+		}
+		if gen.mode == "compressible" && gen.ratio < 1 {
+			gen.ratio = 1
+		}
+	default:
+		return nil, fmt.Errorf("unknown payload mode: %s", gen.mode)
+	}
+	return gen, nil
+}
+
+func (g *payloadGenerator) build(state *templateState) ([]byte, error) {
+	switch g.mode {
+	case "schema":
+		return g.schema.encode(state.rng)
+	case "nested":
+		return json.Marshal(expandNested(g.nested, state))
+	case "template":
+		return []byte(expandTemplate(g.template, state)), nil
+	case "fixed", "random":
+		return randomText(state.rng, g.size(state.rng)), nil
+	case "binary":
+		out := make([]byte, g.size(state.rng))
+		state.rng.Read(out)
+		return out, nil
+	case "compressible":
+		return compressibleText(state.rng, g.size(state.rng), g.ratio), nil
+	default:
+		if len(g.json) == 0 {
+			return []byte(fmt.Sprintf(`{"uuid":"%s"}`, randomUUID())), nil
+		}
+		payload := make(map[string]string, len(g.json))
+		for _, key := range sortedKeys(g.json) {
+			payload[key] = expandTemplate(g.json[key], state)
+		}
+		return json.Marshal(payload)
+	}
+}
+
+// newProducerPayload builds the generator for a producer value spec and, for
+// schema payloads, registers the schema for the topic's value subject.
+func newProducerPayload(ctx context.Context, spec *scenario.ScenarioFile, value scenario.PayloadSpec, topic string, runID string) (*payloadGenerator, error) {
+	gen, err := newPayloadGenerator(value)
+	if err != nil {
+		return nil, err
+	}
+	switch gen.mode {
+	case "schema":
+		gen.schema, err = newSchemaCodec(ctx, value.Schema, spec.Dir, topic, runID)
+	case "file":
+		gen.corpus, err = loadCorpus(resolvePath(spec.Dir, value.File), value)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return gen, nil
+}
+
+// record builds the key, value, headers and timestamp of the next record.
+// The returned time is when the record should be sent to keep the corpus
+// inter-arrival timing, or zero when it can be sent immediately.
+func (g *payloadGenerator) record(state *templateState) (*kgo.Record, time.Time, error) {
+	if g.corpus != nil {
+		entry, sendAt, err := g.corpus.next(state.rng)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		record := &kgo.Record{
+			Key:     entry.Key,
+			Value:   entry.Value,
+			Headers: append([]kgo.RecordHeader(nil), entry.Headers...),
+		}
+		if g.original {
+			record.Timestamp = entry.Timestamp
+		}
+		return record, sendAt, nil
+	}
+	value, err := g.build(state)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return &kgo.Record{Value: value}, time.Time{}, nil
+}
+
+// corpusSize reports how many records a corpus holds, or 0 for generated payloads.
+func (g *payloadGenerator) corpusSize() int {
+	if g.corpus == nil {
+		return 0
+	}
+	return len(g.corpus.entries)
+}
+
+// close releases the corpus file, if any.
+func (g *payloadGenerator) close() {
+	if g.corpus != nil {
+		g.corpus.close()
+	}
+}
+
+func (g *payloadGenerator) size(rng *rand.Rand) int {
+	if g.maxSize == g.minSize {
+		return g.minSize
+	}
+	return g.minSize + rng.Intn(g.maxSize-g.minSize+1)
+}
+
+func expandNested(value any, state *templateState) any {
+	switch typed := value.(type) {
+	case string:
+		return expandTemplate(typed, state)
+	case map[string]any:
+		out := make(map[string]any, len(typed))
+		for _, key := range sortedKeys(typed) {
+			out[key] = expandNested(typed[key], state)
+		}
+		return out
+	case []any:
+		out := make([]any, len(typed))
+		for i, val := range typed {
+			out[i] = expandNested(val, state)
+		}
+		return out
+	default:
+		return typed
+	}
+}
+
+// sortedKeys keeps template expansion order stable so seeded runs draw the
+// same random values for the same fields.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func randomText(rng *rand.Rand, size int) []byte {
+	out := make([]byte, size)
+	for i := range out {
+		out[i] = alphanumeric[rng.Intn(len(alphanumeric))]
+	}
+	return out
+}
+
+// compressibleText fills roughly 1/ratio of the value with random text and
+// the rest with a repeated run, so a general-purpose codec reaches about the
+// requested compression ratio.
+func compressibleText(rng *rand.Rand, size int, ratio float64) []byte {
+	random := int(float64(size) / ratio)
+	out := randomText(rng, size)
+	for i := random; i < size; i++ {
+		out[i] = 'a'
+	}
+	return out
+}
+
+func parseSize(input string) (int, error) {
+	value := strings.ToUpper(strings.TrimSpace(input))
+	multiplier := 1
+	switch {
+	case strings.HasSuffix(value, "MB"):
+		multiplier = 1024 * 1024
+		value = strings.TrimSuffix(value, "MB")
+	case strings.HasSuffix(value, "KB"):
+		multiplier = 1024
+		value = strings.TrimSuffix(value, "KB")
+	case strings.HasSuffix(value, "B"):
+		value = strings.TrimSuffix(value, "B")
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size: %s", input)
+	}
+	return n * multiplier, nil
+}
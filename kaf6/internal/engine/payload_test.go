@@ -0,0 +1,140 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package engine
+
+import (
+	"bytes"
+	"compress/gzip"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		input string
+		want  int
+		err   bool
+	}{
+		{"512", 512, false},
+		{"512B", 512, false},
+		{"4kb", 4096, false},
+		{" 2 KB ", 2048, false},
+		{"1MB", 1024 * 1024, false},
+		{"0", 0, false},
+		{"", 0, true},
+		{"-1KB", 0, true},
+		{"1.5MB", 0, true},
+		{"1GB", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := parseSize(tt.input)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("parseSize(%q) = %d, want an error", tt.input, got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("parseSize(%q) = %d, %v, want %d", tt.input, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandTemplate(t *testing.T) {
+	t.Setenv("KAF6_TEST_ZONE", "z1")
+	state := newTemplateState("run1", 2, 42)
+	state.seq = 7
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"plain", "plain"},
+		{"{{run_id}}-{{client_id}}-{{seq}}", "run1-2-7"},
+		{"{{ seq }}", "7"},
+		{"zone={{env KAF6_TEST_ZONE}}", "zone=z1"},
+		{"{{env KAF6_TEST_UNSET_VAR}}", ""},
+		{"{{env}}", "{{env}}"},
+		{"{{rand_int 5 5}}", "5"},
+		{"{{rand_int 9 1}}", "{{rand_int 9 1}}"},
+		{"{{rand_int x 1}}", "{{rand_int x 1}}"},
+		{"{{nope}}", "{{nope}}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := expandTemplate(tt.input, state); got != tt.want {
+				t.Fatalf("expandTemplate(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandTemplateRandInt(t *testing.T) {
+	state := newTemplateState("run1", 0, 1)
+	seen := make(map[int]bool)
+	for i := 0; i < 200; i++ {
+		n, err := strconv.Atoi(expandTemplate("{{rand_int -2 2}}", state))
+		if err != nil || n < -2 || n > 2 {
+			t.Fatalf("rand_int -2 2 = %d, %v", n, err)
+		}
+		seen[n] = true
+	}
+	if len(seen) != 5 {
+		t.Fatalf("rand_int -2 2 covered %v, want all 5 values", seen)
+	}
+	again := newTemplateState("run1", 0, 1)
+	first := newTemplateState("run1", 0, 1)
+	if expandTemplate("{{rand_int 0 1000000}}", again) != expandTemplate("{{rand_int 0 1000000}}", first) {
+		t.Fatal("the same seed and client gave different values")
+	}
+}
+
+func TestRandomUUIDIsUnseeded(t *testing.T) {
+	pattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	a := expandTemplate("{{uuid}}", newTemplateState("run1", 0, 42))
+	b := expandTemplate("{{uuid}}", newTemplateState("run1", 0, 42))
+	if !pattern.MatchString(a) || !pattern.MatchString(b) {
+		t.Fatalf("uuids %q %q are not version 4", a, b)
+	}
+	if a == b {
+		t.Fatalf("seeded runs repeated uuid %s", a)
+	}
+}
+
+func TestCompressibleTextRatio(t *testing.T) {
+	const size = 64 * 1024
+	for _, ratio := range []float64{1, 2, 4, 8} {
+		value := compressibleText(rand.New(rand.NewSource(1)), size, ratio)
+		if len(value) != size {
+			t.Fatalf("ratio %v: len = %d, want %d", ratio, len(value), size)
+		}
+		var compressed bytes.Buffer
+		writer := gzip.NewWriter(&compressed)
+		writer.Write(value)
+		writer.Close()
+		achieved := float64(size) / float64(compressed.Len())
+		// Random alphanumeric text itself shrinks a little under gzip, so
+		// the achieved ratio lands somewhat above the requested one.
+		if achieved < ratio*0.9 || achieved > ratio*1.4 {
+			t.Errorf("ratio %v: gzip achieved %.2f", ratio, achieved)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package engine
+
+import (
+	"sync"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+const defaultInFlight = 1000
+
+// ProducerResult describes how the producer sent its records. Batch and
+// request counts come from client hooks, so they show what the client
+// actually wrote rather than what was handed to it.
+type ProducerResult struct {
+	Mode                 string
+	InFlight             int
+	Linger               time.Duration
+	Acked                int64
+	Duration             time.Duration
+	RecordsPerSecond     float64
+	Batches              int64
+	Requests             int64
+	MaxBatchRecords      int
+	AvgBatchRecords      float64
+	AvgBatchBytes        float64
+	AvgRecordsPerRequest float64
+}
+
+// produceRecorder counts written batches and produce requests.
+type produceRecorder struct {
+	mu              sync.Mutex
+	batches         int64
+	batchRecords    int64
+	batchBytes      int64
+	maxBatchRecords int
+	requests        int64
+}
+
+func (r *produceRecorder) OnProduceBatchWritten(_ kgo.BrokerMetadata, _ string, _ int32, m kgo.ProduceBatchMetrics) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.batches++
+	r.batchRecords += int64(m.NumRecords)
+	r.batchBytes += int64(m.UncompressedBytes)
+	r.maxBatchRecords = max(r.maxBatchRecords, m.NumRecords)
+}
+
+func (r *produceRecorder) OnBrokerWrite(_ kgo.BrokerMetadata, key int16, _ int, _, _ time.Duration, err error) {
+	if key != 0 || err != nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests++
+}
+
+func (r *produceRecorder) fill(result *ProducerResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result.Batches = r.batches
+	result.Requests = r.requests
+	result.MaxBatchRecords = r.maxBatchRecords
+	if r.batches > 0 {
+		result.AvgBatchRecords = float64(r.batchRecords) / float64(r.batches)
+		result.AvgBatchBytes = float64(r.batchBytes) / float64(r.batches)
+	}
+	if r.requests > 0 {
+		result.AvgRecordsPerRequest = float64(r.batchRecords) / float64(r.requests)
+	}
+	if result.Duration > 0 {
+		result.RecordsPerSecond = float64(result.Acked) / result.Duration.Seconds()
+	}
+}
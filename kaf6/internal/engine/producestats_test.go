@@ -0,0 +1,59 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package engine
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func TestProduceRecorderFill(t *testing.T) {
+	r := &produceRecorder{}
+	meta := kgo.BrokerMetadata{}
+	r.OnProduceBatchWritten(meta, "topic", 0, kgo.ProduceBatchMetrics{NumRecords: 10, UncompressedBytes: 1000})
+	r.OnProduceBatchWritten(meta, "topic", 1, kgo.ProduceBatchMetrics{NumRecords: 30, UncompressedBytes: 2000})
+	r.OnBrokerWrite(meta, 0, 512, 0, 0, nil)
+	r.OnBrokerWrite(meta, 0, 512, 0, 0, errors.New("connection reset"))
+	r.OnBrokerWrite(meta, 3, 64, 0, 0, nil)
+
+	result := &ProducerResult{Acked: 40, Duration: 2 * time.Second}
+	r.fill(result)
+	want := ProducerResult{
+		Acked:                40,
+		Duration:             2 * time.Second,
+		RecordsPerSecond:     20,
+		Batches:              2,
+		Requests:             1,
+		MaxBatchRecords:      30,
+		AvgBatchRecords:      20,
+		AvgBatchBytes:        1500,
+		AvgRecordsPerRequest: 40,
+	}
+	if *result != want {
+		t.Fatalf("got %+v, want %+v", *result, want)
+	}
+
+	empty := &ProducerResult{}
+	(&produceRecorder{}).fill(empty)
+	if *empty != (ProducerResult{}) {
+		t.Fatalf("empty recorder filled %+v", *empty)
+	}
+}
@@ -0,0 +1,1017 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package engine
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hamba/avro/v2"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"kaf6/internal/registry"
+	"kaf6/internal/scenario"
+)
+
+// maxSchemaDepth bounds recursion when generating values for nested or
+// recursive schemas.
+const maxSchemaDepth = 3
+
+// schemaCodec generates and validates records in the Confluent wire format:
+// a zero magic byte, a big-endian schema ID, then the serialized value
+// (Protobuf values also carry the message index path).
+type schemaCodec struct {
+	kind     string
+	id       int
+	avro     avro.Schema
+	proto    protoreflect.MessageDescriptor
+	indexes  []int
+	json     map[string]any
+	registry *registry.Client
+
+	mu     sync.Mutex
+	known  map[int]bool
+	writer map[int]avro.Schema
+}
+
+func newSchemaCodec(ctx context.Context, spec *scenario.SchemaSpec, baseDir string, topic string, runID string) (*schemaCodec, error) {
+	if spec.File == "" {
+		return nil, fmt.Errorf("schema file is required")
+	}
+	raw, err := os.ReadFile(resolvePath(baseDir, spec.File))
+	if err != nil {
+		return nil, err
+	}
+	codec := &schemaCodec{
+		kind:   spec.Type,
+		known:  make(map[int]bool),
+		writer: make(map[int]avro.Schema),
+	}
+	var text, schemaType string
+	switch spec.Type {
+	case "avro":
+		codec.avro, err = avro.Parse(string(raw))
+		if err != nil {
+			return nil, fmt.Errorf("parse avro schema: %w", err)
+		}
+		text = codec.avro.String()
+	case "protobuf":
+		if codec.proto, err = loadMessageDescriptor(raw, spec.Message); err != nil {
+			return nil, err
+		}
+		codec.indexes = messageIndexes(codec.proto)
+		text = base64.StdEncoding.EncodeToString(raw)
+		if spec.Source != "" {
+			source, err := os.ReadFile(resolvePath(baseDir, spec.Source))
+			if err != nil {
+				return nil, err
+			}
+			text = string(source)
+		}
+		schemaType = "PROTOBUF"
+	case "json":
+		if err := json.Unmarshal(raw, &codec.json); err != nil {
+			return nil, fmt.Errorf("parse json schema: %w", err)
+		}
+		if err := checkJSONSchema(codec.json, "$"); err != nil {
+			return nil, fmt.Errorf("json schema: %w", err)
+		}
+		text = string(raw)
+		schemaType = "JSON"
+	default:
+		return nil, fmt.Errorf("unknown schema type: %s", spec.Type)
+	}
+
+	codec.id = spec.ID
+	if spec.Registry != "" {
+		codec.registry = registry.NewClient(spec.Registry)
+		subject := replaceRunID(spec.Subject, runID)
+		if subject == "" {
+			subject = topic + "-value"
+		}
+		codec.id, err = codec.registry.Register(ctx, subject, text, schemaType)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if codec.id <= 0 {
+		codec.id = 1
+	}
+	return codec, nil
+}
+
+func resolvePath(baseDir string, path string) string {
+	if filepath.IsAbs(path) || baseDir == "" {
+		return path
+	}
+	return filepath.Join(baseDir, path)
+}
+
+func loadMessageDescriptor(raw []byte, message string) (protoreflect.MessageDescriptor, error) {
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(raw, &set); err != nil {
+		return nil, fmt.Errorf("parse descriptor set: %w", err)
+	}
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, fmt.Errorf("load descriptor set: %w", err)
+	}
+	desc, err := files.FindDescriptorByName(protoreflect.FullName(message))
+	if err != nil {
+		return nil, fmt.Errorf("find message %s: %w", message, err)
+	}
+	md, ok := desc.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a message", message)
+	}
+	return md, nil
+}
+
+func messageIndexes(md protoreflect.MessageDescriptor) []int {
+	var out []int
+	var desc protoreflect.Descriptor = md
+	for {
+		msg, ok := desc.(protoreflect.MessageDescriptor)
+		if !ok {
+			break
+		}
+		out = append([]int{msg.Index()}, out...)
+		desc = msg.Parent()
+	}
+	return out
+}
+
+func (c *schemaCodec) encode(rng *rand.Rand) ([]byte, error) {
+	out := []byte{0}
+	out = binary.BigEndian.AppendUint32(out, uint32(c.id))
+	switch c.kind {
+	case "avro":
+		body, err := avro.Marshal(c.avro, randomAvro(c.avro, rng, 0))
+		if err != nil {
+			return nil, err
+		}
+		return append(out, body...), nil
+	case "protobuf":
+		if len(c.indexes) == 1 && c.indexes[0] == 0 {
+			out = append(out, 0)
+		} else {
+			out = binary.AppendVarint(out, int64(len(c.indexes)))
+			for _, idx := range c.indexes {
+				out = binary.AppendVarint(out, int64(idx))
+			}
+		}
+		msg := dynamicpb.NewMessage(c.proto)
+		fillProto(msg, rng, 0)
+		body, err := proto.Marshal(msg)
+		if err != nil {
+			return nil, err
+		}
+		return append(out, body...), nil
+	default:
+		document, err := randomJSON(c.json, rng, 0)
+		if err != nil {
+			return nil, err
+		}
+		body, err := json.Marshal(document)
+		if err != nil {
+			return nil, err
+		}
+		return append(out, body...), nil
+	}
+}
+
+func (c *schemaCodec) validate(ctx context.Context, value []byte) error {
+	if len(value) < 5 || value[0] != 0 {
+		return fmt.Errorf("missing schema registry magic byte")
+	}
+	id := int(binary.BigEndian.Uint32(value[1:5]))
+	body := value[5:]
+	writer := c.avro
+	if c.registry != nil {
+		resolved, err := c.lookup(ctx, id)
+		if err != nil {
+			return err
+		}
+		if resolved != nil {
+			writer = resolved
+		}
+	} else if id != c.id {
+		return fmt.Errorf("schema id %d, expected %d", id, c.id)
+	}
+	switch c.kind {
+	case "avro":
+		if err := decodeAvro(writer, body); err != nil {
+			return fmt.Errorf("decode avro: %w", err)
+		}
+	case "protobuf":
+		count, n := binary.Varint(body)
+		if n <= 0 {
+			return fmt.Errorf("invalid message index header")
+		}
+		body = body[n:]
+		indexes := []int{0}
+		if count > 0 {
+			indexes = indexes[:0]
+			for i := int64(0); i < count; i++ {
+				idx, n := binary.Varint(body)
+				if n <= 0 {
+					return fmt.Errorf("invalid message index header")
+				}
+				indexes = append(indexes, int(idx))
+				body = body[n:]
+			}
+		}
+		if !reflect.DeepEqual(indexes, c.indexes) {
+			return fmt.Errorf("message indexes %v, expected %v", indexes, c.indexes)
+		}
+		msg := dynamicpb.NewMessage(c.proto)
+		if err := proto.Unmarshal(body, msg); err != nil {
+			return fmt.Errorf("decode protobuf: %w", err)
+		}
+		if err := proto.CheckInitialized(msg); err != nil {
+			return err
+		}
+	default:
+		var decoded any
+		if err := json.Unmarshal(body, &decoded); err != nil {
+			return fmt.Errorf("decode json: %w", err)
+		}
+		if err := validateJSON(c.json, decoded, "$"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lookup confirms the schema ID exists in the registry and, for Avro,
+// returns the registered writer schema so decoding follows the same path as
+// a registry-aware consumer.
+func (c *schemaCodec) lookup(ctx context.Context, id int) (avro.Schema, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.known[id] {
+		return c.writer[id], nil
+	}
+	schema, err := c.registry.SchemaByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	c.known[id] = true
+	if c.kind == "avro" {
+		parsed, err := avro.Parse(schema.Schema)
+		if err != nil {
+			return nil, fmt.Errorf("parse registry schema %d: %w", id, err)
+		}
+		c.writer[id] = parsed
+	}
+	return c.writer[id], nil
+}
+
+// randomAvro generates a value of the given schema in the generic form
+// avro.Marshal takes: maps for records and maps, slices for arrays, and a
+// single-entry map naming the chosen branch for unions.
+func randomAvro(schema avro.Schema, rng *rand.Rand, depth int) any {
+	switch s := schema.(type) {
+	case *avro.NullSchema:
+		return nil
+	case *avro.RefSchema:
+		return randomAvro(s.Schema(), rng, depth)
+	case *avro.RecordSchema:
+		record := make(map[string]any, len(s.Fields()))
+		for _, field := range s.Fields() {
+			record[field.Name()] = randomAvro(field.Type(), rng, depth+1)
+		}
+		return record
+	case *avro.EnumSchema:
+		return s.Symbols()[rng.Intn(len(s.Symbols()))]
+	case *avro.FixedSchema:
+		fixed := reflect.New(reflect.ArrayOf(s.Size(), reflect.TypeFor[byte]())).Elem()
+		rng.Read(fixed.Slice(0, s.Size()).Bytes())
+		return fixed.Interface()
+	case *avro.ArraySchema:
+		count := 0
+		if depth < maxSchemaDepth {
+			count = rng.Intn(3)
+		}
+		items := make([]any, count)
+		for i := range items {
+			items[i] = randomAvro(s.Items(), rng, depth+1)
+		}
+		return items
+	case *avro.MapSchema:
+		count := 0
+		if depth < maxSchemaDepth {
+			count = rng.Intn(3)
+		}
+		values := make(map[string]any, count)
+		for i := 0; i < count; i++ {
+			values[fmt.Sprintf("k%d", i)] = randomAvro(s.Values(), rng, depth+1)
+		}
+		return values
+	case *avro.UnionSchema:
+		types := s.Types()
+		idx := rng.Intn(len(types))
+		if depth >= maxSchemaDepth {
+			for i, typ := range types {
+				if typ.Type() == avro.Null {
+					idx = i
+					break
+				}
+			}
+		}
+		return map[string]any{avroBranchName(types[idx]): randomAvro(types[idx], rng, depth+1)}
+	case *avro.PrimitiveSchema:
+		logical := ""
+		if s.Logical() != nil {
+			logical = string(s.Logical().Type())
+		}
+		switch s.Type() {
+		case avro.Boolean:
+			return rng.Intn(2) == 1
+		case avro.Int:
+			switch logical {
+			case "date":
+				return int32(time.Now().Unix() / 86400)
+			case "time-millis":
+				return time.Duration(rng.Int63n(int64(24 * time.Hour))).Truncate(time.Millisecond)
+			}
+			return rng.Int31n(1 << 20)
+		case avro.Long:
+			switch logical {
+			case "timestamp-millis", "local-timestamp-millis":
+				return time.Now().UnixMilli()
+			case "timestamp-micros", "local-timestamp-micros":
+				return time.Now().UnixMicro()
+			case "time-micros":
+				return time.Duration(rng.Int63n(int64(24 * time.Hour))).Truncate(time.Microsecond)
+			}
+			return rng.Int63n(1 << 40)
+		case avro.Float:
+			return rng.Float32() * 1000
+		case avro.Double:
+			return rng.Float64() * 1000
+		case avro.String:
+			if logical == "uuid" {
+				return randomUUID()
+			}
+			return string(randomText(rng, 1+rng.Intn(16)))
+		case avro.Bytes:
+			value := make([]byte, 1+rng.Intn(16))
+			rng.Read(value)
+			return value
+		}
+	}
+	return nil
+}
+
+// avroBranchName is the key avro.Marshal expects for a union branch: the
+// full name of a named type, otherwise the type with its logical type.
+func avroBranchName(schema avro.Schema) string {
+	if ref, ok := schema.(*avro.RefSchema); ok {
+		schema = ref.Schema()
+	}
+	if named, ok := schema.(avro.NamedSchema); ok {
+		return named.FullName()
+	}
+	if primitive, ok := schema.(*avro.PrimitiveSchema); ok && primitive.Logical() != nil {
+		return string(primitive.Type()) + "." + string(primitive.Logical().Type())
+	}
+	return string(schema.Type())
+}
+
+// decodeAvro decodes one value the way avro.Unmarshal does, but on a reader
+// it keeps, so bytes left after the value are reported instead of ignored.
+// Strings must be valid UTF-8, which the decoder does not check.
+func decodeAvro(schema avro.Schema, data []byte) error {
+	reader := avro.NewReader(nil, 0).Reset(data)
+	var value any
+	reader.ReadVal(schema, &value)
+	if reader.Error != nil {
+		return reader.Error
+	}
+	if reader.Peek(); reader.Error == nil {
+		return fmt.Errorf("trailing bytes")
+	}
+	return checkAvroStrings(value)
+}
+
+func checkAvroStrings(value any) error {
+	switch typed := value.(type) {
+	case string:
+		if !utf8.ValidString(typed) {
+			return fmt.Errorf("invalid utf-8 string")
+		}
+	case []any:
+		for _, item := range typed {
+			if err := checkAvroStrings(item); err != nil {
+				return err
+			}
+		}
+	case map[string]any:
+		for key, item := range typed {
+			if !utf8.ValidString(key) {
+				return fmt.Errorf("invalid utf-8 map key")
+			}
+			if err := checkAvroStrings(item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func fillProto(msg protoreflect.Message, rng *rand.Rand, depth int) {
+	desc := msg.Descriptor()
+	chosen := make(map[protoreflect.FullName]protoreflect.Name)
+	oneofs := desc.Oneofs()
+	for i := 0; i < oneofs.Len(); i++ {
+		oneof := oneofs.Get(i)
+		if oneof.IsSynthetic() {
+			continue
+		}
+		chosen[oneof.FullName()] = oneof.Fields().Get(rng.Intn(oneof.Fields().Len())).Name()
+	}
+	fields := desc.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if oneof := fd.ContainingOneof(); oneof != nil && !oneof.IsSynthetic() && chosen[oneof.FullName()] != fd.Name() {
+			continue
+		}
+		isMessage := fd.Kind() == protoreflect.MessageKind || fd.Kind() == protoreflect.GroupKind
+		switch {
+		case fd.IsMap():
+			if depth >= maxSchemaDepth {
+				continue
+			}
+			entries := msg.Mutable(fd).Map()
+			count := rng.Intn(3)
+			for j := 0; j < count; j++ {
+				key := protoScalar(fd.MapKey(), rng).MapKey()
+				if fd.MapValue().Kind() == protoreflect.MessageKind {
+					value := entries.NewValue()
+					fillProto(value.Message(), rng, depth+1)
+					entries.Set(key, value)
+					continue
+				}
+				entries.Set(key, protoScalar(fd.MapValue(), rng))
+			}
+		case fd.IsList():
+			if depth >= maxSchemaDepth {
+				continue
+			}
+			list := msg.Mutable(fd).List()
+			count := rng.Intn(3)
+			for j := 0; j < count; j++ {
+				if isMessage {
+					value := list.NewElement()
+					fillProto(value.Message(), rng, depth+1)
+					list.Append(value)
+					continue
+				}
+				list.Append(protoScalar(fd, rng))
+			}
+		case isMessage:
+			if depth >= maxSchemaDepth && fd.Cardinality() != protoreflect.Required {
+				continue
+			}
+			fillProto(msg.Mutable(fd).Message(), rng, depth+1)
+		default:
+			msg.Set(fd, protoScalar(fd, rng))
+		}
+	}
+}
+
+func protoScalar(fd protoreflect.FieldDescriptor, rng *rand.Rand) protoreflect.Value {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return protoreflect.ValueOfBool(rng.Intn(2) == 1)
+	case protoreflect.EnumKind:
+		values := fd.Enum().Values()
+		return protoreflect.ValueOfEnum(values.Get(rng.Intn(values.Len())).Number())
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return protoreflect.ValueOfInt32(rng.Int31n(1 << 20))
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return protoreflect.ValueOfInt64(rng.Int63n(1 << 40))
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return protoreflect.ValueOfUint32(uint32(rng.Int31n(1 << 20)))
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return protoreflect.ValueOfUint64(uint64(rng.Int63n(1 << 40)))
+	case protoreflect.FloatKind:
+		return protoreflect.ValueOfFloat32(rng.Float32() * 1000)
+	case protoreflect.DoubleKind:
+		return protoreflect.ValueOfFloat64(rng.Float64() * 1000)
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(string(randomText(rng, 1+rng.Intn(16))))
+	default:
+		value := make([]byte, 1+rng.Intn(16))
+		rng.Read(value)
+		return protoreflect.ValueOfBytes(value)
+	}
+}
+
+func jsonSchemaType(schema map[string]any) string {
+	switch typed := schema["type"].(type) {
+	case string:
+		return typed
+	case []any:
+		for _, entry := range typed {
+			if name, ok := entry.(string); ok && name != "null" {
+				return name
+			}
+		}
+		return "null"
+	}
+	if _, ok := schema["properties"]; ok {
+		return "object"
+	}
+	if _, ok := schema["items"]; ok {
+		return "array"
+	}
+	return ""
+}
+
+func jsonNumber(schema map[string]any, key string) (float64, bool) {
+	value, ok := schema[key].(float64)
+	return value, ok
+}
+
+// jsonBounds returns the numeric range of a schema. exclusiveMinimum and
+// exclusiveMaximum are accepted both as draft 4 booleans that qualify
+// minimum/maximum and as the later standalone numbers. Without bounds the
+// range is [0, 1000], or 1000 wide next to the single bound given.
+func jsonBounds(schema map[string]any) (low float64, lowExclusive bool, high float64, highExclusive bool) {
+	minimum, hasMin := jsonNumber(schema, "minimum")
+	maximum, hasMax := jsonNumber(schema, "maximum")
+	if flag, ok := schema["exclusiveMinimum"].(bool); ok && hasMin {
+		lowExclusive = flag
+	}
+	if flag, ok := schema["exclusiveMaximum"].(bool); ok && hasMax {
+		highExclusive = flag
+	}
+	if value, ok := jsonNumber(schema, "exclusiveMinimum"); ok && (!hasMin || value >= minimum) {
+		minimum, hasMin, lowExclusive = value, true, true
+	}
+	if value, ok := jsonNumber(schema, "exclusiveMaximum"); ok && (!hasMax || value <= maximum) {
+		maximum, hasMax, highExclusive = value, true, true
+	}
+	switch {
+	case hasMin && hasMax:
+		return minimum, lowExclusive, maximum, highExclusive
+	case hasMin:
+		return minimum, lowExclusive, minimum + 1000, false
+	case hasMax:
+		return min(0, maximum-1000), false, maximum, highExclusive
+	}
+	return 0, false, 1000, false
+}
+
+// integerBounds narrows the numeric range of a schema to the integers in it.
+func integerBounds(schema map[string]any) (int64, int64, error) {
+	low, lowExclusive, high, highExclusive := jsonBounds(schema)
+	first, last := math.Ceil(low), math.Floor(high)
+	if lowExclusive && first == low {
+		first++
+	}
+	if highExclusive && last == high {
+		last--
+	}
+	if last < first {
+		return 0, 0, fmt.Errorf("no integer between %v and %v", low, high)
+	}
+	return int64(first), int64(last), nil
+}
+
+// checkJSONSchema rejects schemas kaf6 cannot generate valid documents for:
+// empty numeric ranges, string length limits that exclude every string and
+// patterns that do not compile.
+func checkJSONSchema(schema map[string]any, path string) error {
+	switch jsonSchemaType(schema) {
+	case "integer":
+		if _, _, err := integerBounds(schema); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	case "number":
+		low, lowExclusive, high, highExclusive := jsonBounds(schema)
+		if high < low || (high == low && (lowExclusive || highExclusive)) {
+			return fmt.Errorf("%s: no number between %v and %v", path, low, high)
+		}
+	case "string":
+		minLength, hasMin := jsonNumber(schema, "minLength")
+		maxLength, hasMax := jsonNumber(schema, "maxLength")
+		if hasMin && hasMax && maxLength < minLength {
+			return fmt.Errorf("%s: maxLength %v below minLength %v", path, maxLength, minLength)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("%s: invalid pattern: %w", path, err)
+			}
+		}
+	}
+	props, _ := schema["properties"].(map[string]any)
+	for _, key := range sortedKeys(props) {
+		if prop, ok := props[key].(map[string]any); ok {
+			if err := checkJSONSchema(prop, path+"."+key); err != nil {
+				return err
+			}
+		}
+	}
+	if items, ok := schema["items"].(map[string]any); ok {
+		if err := checkJSONSchema(items, path+"[]"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func randomJSON(schema map[string]any, rng *rand.Rand, depth int) (any, error) {
+	if value, ok := schema["const"]; ok {
+		return value, nil
+	}
+	if values, ok := schema["enum"].([]any); ok && len(values) > 0 {
+		return values[rng.Intn(len(values))], nil
+	}
+	switch jsonSchemaType(schema) {
+	case "object":
+		out := make(map[string]any)
+		props, _ := schema["properties"].(map[string]any)
+		required := make(map[string]bool)
+		if names, ok := schema["required"].([]any); ok {
+			for _, name := range names {
+				if key, ok := name.(string); ok {
+					required[key] = true
+				}
+			}
+		}
+		for _, key := range sortedKeys(props) {
+			prop, ok := props[key].(map[string]any)
+			if !ok {
+				continue
+			}
+			if required[key] || (depth < maxSchemaDepth && rng.Intn(2) == 0) {
+				value, err := randomJSON(prop, rng, depth+1)
+				if err != nil {
+					return nil, err
+				}
+				out[key] = value
+			}
+		}
+		return out, nil
+	case "array":
+		items, _ := schema["items"].(map[string]any)
+		low, high := 0, 3
+		if depth >= maxSchemaDepth {
+			high = 0
+		}
+		if value, ok := jsonNumber(schema, "minItems"); ok {
+			low = int(value)
+		}
+		if value, ok := jsonNumber(schema, "maxItems"); ok && int(value) < high {
+			high = int(value)
+		}
+		if high < low {
+			high = low
+		}
+		out := make([]any, low+rng.Intn(high-low+1))
+		for i := range out {
+			value, err := randomJSON(items, rng, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = value
+		}
+		return out, nil
+	case "integer":
+		first, last, err := integerBounds(schema)
+		if err != nil {
+			return nil, err
+		}
+		return first + rng.Int63n(last-first+1), nil
+	case "number":
+		low, lowExclusive, high, highExclusive := jsonBounds(schema)
+		if high < low || (high == low && (lowExclusive || highExclusive)) {
+			return nil, fmt.Errorf("no number between %v and %v", low, high)
+		}
+		value := low + rng.Float64()*(high-low)
+		if (lowExclusive && value <= low) || (highExclusive && value >= high) {
+			value = low + (high-low)/2
+		}
+		return value, nil
+	case "boolean":
+		return rng.Intn(2) == 1, nil
+	case "null":
+		return nil, nil
+	default:
+		switch schema["format"] {
+		case "date-time":
+			return time.Now().UTC().Format(time.RFC3339Nano), nil
+		case "uuid":
+			return randomUUID(), nil
+		}
+		low, high := 1, 12
+		if value, ok := jsonNumber(schema, "minLength"); ok {
+			low = int(value)
+			high = max(high, low)
+		}
+		if value, ok := jsonNumber(schema, "maxLength"); ok {
+			high = int(value)
+			low = min(low, high)
+		}
+		if high < low {
+			return nil, fmt.Errorf("maxLength %d below minLength %d", high, low)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			// Only explicit limits constrain a pattern, not the defaults above.
+			minLength, maxLength := 0, math.MaxInt
+			if value, ok := jsonNumber(schema, "minLength"); ok {
+				minLength = int(value)
+			}
+			if value, ok := jsonNumber(schema, "maxLength"); ok {
+				maxLength = int(value)
+			}
+			return randomPatternString(pattern, minLength, maxLength, rng)
+		}
+		return string(randomText(rng, low+rng.Intn(high-low+1))), nil
+	}
+}
+
+// maxPatternAttempts bounds how often a string is generated from a pattern
+// before giving up on also meeting the length limits.
+const maxPatternAttempts = 50
+
+// randomPatternString generates a string from the regular expression itself
+// and keeps the first one that matches and fits the length limits.
+func randomPatternString(pattern string, minLength int, maxLength int, rng *rand.Rand) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", fmt.Errorf("invalid pattern: %w", err)
+	}
+	parsed, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return "", fmt.Errorf("invalid pattern: %w", err)
+	}
+	parsed = parsed.Simplify()
+	for range maxPatternAttempts {
+		var out strings.Builder
+		if err := appendPatternMatch(&out, parsed, rng); err != nil {
+			return "", err
+		}
+		candidate := out.String()
+		length := utf8.RuneCountInString(candidate)
+		if length >= minLength && length <= maxLength && re.MatchString(candidate) {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("no string of length %d-%d matching %s found", minLength, maxLength, pattern)
+}
+
+func appendPatternMatch(out *strings.Builder, re *syntax.Regexp, rng *rand.Rand) error {
+	switch re.Op {
+	case syntax.OpNoMatch:
+		return fmt.Errorf("pattern matches nothing")
+	case syntax.OpLiteral:
+		for _, r := range re.Rune {
+			out.WriteRune(r)
+		}
+	case syntax.OpCharClass:
+		out.WriteRune(randomClassRune(re.Rune, rng))
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		out.WriteByte(alphanumeric[rng.Intn(len(alphanumeric))])
+	case syntax.OpCapture:
+		return appendPatternMatch(out, re.Sub[0], rng)
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			if err := appendPatternMatch(out, sub, rng); err != nil {
+				return err
+			}
+		}
+	case syntax.OpAlternate:
+		return appendPatternMatch(out, re.Sub[rng.Intn(len(re.Sub))], rng)
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		low, high := re.Min, re.Max
+		switch re.Op {
+		case syntax.OpStar:
+			low, high = 0, 3
+		case syntax.OpPlus:
+			low, high = 1, 4
+		case syntax.OpQuest:
+			low, high = 0, 1
+		}
+		if high < 0 {
+			high = low + 3
+		}
+		for range low + rng.Intn(high-low+1) {
+			if err := appendPatternMatch(out, re.Sub[0], rng); err != nil {
+				return err
+			}
+		}
+	}
+	// Anchors, boundaries and empty matches produce no text.
+	return nil
+}
+
+// randomClassRune picks a rune from a character class, preferring printable
+// ASCII so that negated classes do not produce control characters.
+func randomClassRune(ranges []rune, rng *rand.Rand) rune {
+	var printable []rune
+	for i := 0; i+1 < len(ranges); i += 2 {
+		low, high := max(ranges[i], ' '), min(ranges[i+1], '~')
+		if low <= high {
+			printable = append(printable, low, high)
+		}
+	}
+	if len(printable) > 0 {
+		ranges = printable
+	}
+	pair := rng.Intn(len(ranges)/2) * 2
+	low, high := ranges[pair], ranges[pair+1]
+	return low + rune(rng.Intn(int(high-low)+1))
+}
+
+// validateJSON checks a decoded document against the JSON Schema keywords
+// kaf6 generates from: type, enum, const, properties, required,
+// additionalProperties, items, min/maxItems, min/maxLength, pattern,
+// minimum/maximum and exclusiveMinimum/exclusiveMaximum.
+func validateJSON(schema map[string]any, value any, path string) error {
+	if expected, ok := schema["const"]; ok && !reflect.DeepEqual(expected, value) {
+		return fmt.Errorf("%s: expected const %v", path, expected)
+	}
+	if values, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, candidate := range values {
+			if reflect.DeepEqual(candidate, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: %v not in enum", path, value)
+		}
+	}
+	if !jsonTypeMatches(schema["type"], value) {
+		return fmt.Errorf("%s: unexpected type %T", path, value)
+	}
+	switch typed := value.(type) {
+	case map[string]any:
+		props, _ := schema["properties"].(map[string]any)
+		if names, ok := schema["required"].([]any); ok {
+			for _, name := range names {
+				if key, ok := name.(string); ok {
+					if _, present := typed[key]; !present {
+						return fmt.Errorf("%s: missing required property %s", path, key)
+					}
+				}
+			}
+		}
+		for _, key := range sortedKeys(typed) {
+			if prop, ok := props[key].(map[string]any); ok {
+				if err := validateJSON(prop, typed[key], path+"."+key); err != nil {
+					return err
+				}
+				continue
+			}
+			switch extra := schema["additionalProperties"].(type) {
+			case bool:
+				if !extra {
+					return fmt.Errorf("%s: unexpected property %s", path, key)
+				}
+			case map[string]any:
+				if err := validateJSON(extra, typed[key], path+"."+key); err != nil {
+					return err
+				}
+			}
+		}
+	case []any:
+		if value, ok := jsonNumber(schema, "minItems"); ok && len(typed) < int(value) {
+			return fmt.Errorf("%s: fewer than %d items", path, int(value))
+		}
+		if value, ok := jsonNumber(schema, "maxItems"); ok && len(typed) > int(value) {
+			return fmt.Errorf("%s: more than %d items", path, int(value))
+		}
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range typed {
+				if err := validateJSON(items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case string:
+		length := utf8.RuneCountInString(typed)
+		if value, ok := jsonNumber(schema, "minLength"); ok && length < int(value) {
+			return fmt.Errorf("%s: shorter than %d", path, int(value))
+		}
+		if value, ok := jsonNumber(schema, "maxLength"); ok && length > int(value) {
+			return fmt.Errorf("%s: longer than %d", path, int(value))
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return fmt.Errorf("%s: invalid pattern: %w", path, err)
+			}
+			if !re.MatchString(typed) {
+				return fmt.Errorf("%s: does not match %s", path, pattern)
+			}
+		}
+	case float64:
+		if value, ok := jsonNumber(schema, "minimum"); ok && typed < value {
+			return fmt.Errorf("%s: below minimum %v", path, value)
+		}
+		if value, ok := jsonNumber(schema, "maximum"); ok && typed > value {
+			return fmt.Errorf("%s: above maximum %v", path, value)
+		}
+		if value, ok := jsonNumber(schema, "exclusiveMinimum"); ok && typed <= value {
+			return fmt.Errorf("%s: not above exclusive minimum %v", path, value)
+		}
+		if value, ok := jsonNumber(schema, "exclusiveMaximum"); ok && typed >= value {
+			return fmt.Errorf("%s: not below exclusive maximum %v", path, value)
+		}
+		if exclusive, _ := schema["exclusiveMinimum"].(bool); exclusive {
+			if value, ok := jsonNumber(schema, "minimum"); ok && typed == value {
+				return fmt.Errorf("%s: not above exclusive minimum %v", path, value)
+			}
+		}
+		if exclusive, _ := schema["exclusiveMaximum"].(bool); exclusive {
+			if value, ok := jsonNumber(schema, "maximum"); ok && typed == value {
+				return fmt.Errorf("%s: not below exclusive maximum %v", path, value)
+			}
+		}
+	}
+	return nil
+}
+
+func jsonTypeMatches(spec any, value any) bool {
+	var names []string
+	switch typed := spec.(type) {
+	case nil:
+		return true
+	case string:
+		names = []string{typed}
+	case []any:
+		for _, entry := range typed {
+			if name, ok := entry.(string); ok {
+				names = append(names, name)
+			}
+		}
+	}
+	for _, name := range names {
+		switch v := value.(type) {
+		case nil:
+			if name == "null" {
+				return true
+			}
+		case bool:
+			if name == "boolean" {
+				return true
+			}
+		case string:
+			if name == "string" {
+				return true
+			}
+		case float64:
+			if name == "number" || (name == "integer" && v == math.Trunc(v)) {
+				return true
+			}
+		case []any:
+			if name == "array" {
+				return true
+			}
+		case map[string]any:
+			if name == "object" {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package engine
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hamba/avro/v2"
+
+	"kaf6/internal/scenario"
+)
+
+func TestSchemaCodecRoundTrip(t *testing.T) {
+	suiteSchemas := filepath.Join("..", "..", "suite", "schemas")
+	cases := []struct {
+		name   string
+		kind   string
+		file   string
+		schema string
+		msg    string
+	}{
+		{name: "avro order", kind: "avro", file: filepath.Join(suiteSchemas, "order.avsc")},
+		{name: "avro wide union", kind: "avro", schema: `{"type":"record","name":"U","fields":[{"name":"v","type":["null","int","long","string","bytes",{"type":"long","logicalType":"timestamp-micros"},{"type":"enum","name":"E","symbols":["A","B"]},{"type":"fixed","name":"F","size":4}]}]}`},
+		{name: "avro logical types", kind: "avro", schema: `{"type":"record","name":"L","fields":[{"name":"d","type":{"type":"int","logicalType":"date"}},{"name":"tm","type":{"type":"int","logicalType":"time-millis"}},{"name":"tu","type":{"type":"long","logicalType":"time-micros"}},{"name":"lt","type":{"type":"long","logicalType":"local-timestamp-millis"}},{"name":"f","type":"float"},{"name":"b","type":"boolean"},{"name":"h","type":{"type":"fixed","name":"H","size":16}}]}`},
+		{name: "avro recursive", kind: "avro", schema: `{"type":"record","name":"Node","fields":[{"name":"v","type":"int"},{"name":"next","type":["null","Node"]},{"name":"kids","type":{"type":"array","items":"Node"}},{"name":"tags","type":{"type":"map","values":["null","Node"]}}]}`},
+		{name: "protobuf order", kind: "protobuf", file: filepath.Join(suiteSchemas, "order.desc"), msg: "kaf6.Order"},
+		{name: "json order", kind: "json", file: filepath.Join(suiteSchemas, "order.schema.json")},
+		{name: "json pattern", kind: "json", schema: `{"type":"object","required":["sku"],"properties":{"sku":{"type":"string","pattern":"^[A-Z]{3}-[0-9]{4,6}$"}}}`},
+		{name: "json long pattern", kind: "json", schema: `{"type":"string","pattern":"^ORD-[0-9]{16}$"}`},
+		{name: "json pattern with length", kind: "json", schema: `{"type":"string","pattern":"^(ab|cd)+$","minLength":4,"maxLength":6}`},
+		{name: "json negated class", kind: "json", schema: `{"type":"string","pattern":"^[^a-z]{5}$"}`},
+		{name: "json narrow integer", kind: "json", schema: `{"type":"integer","minimum":1.5,"maximum":2.7}`},
+		{name: "json exclusive integer", kind: "json", schema: `{"type":"integer","exclusiveMinimum":1,"exclusiveMaximum":3}`},
+		{name: "json draft4 exclusive integer", kind: "json", schema: `{"type":"integer","minimum":1,"maximum":3,"exclusiveMinimum":true,"exclusiveMaximum":true}`},
+		{name: "json exclusive number", kind: "json", schema: `{"type":"number","exclusiveMinimum":0,"exclusiveMaximum":0.001}`},
+		{name: "json minimum only", kind: "json", schema: `{"type":"integer","minimum":5000}`},
+		{name: "json maximum only", kind: "json", schema: `{"type":"integer","maximum":-5000}`},
+		{name: "json min length only", kind: "json", schema: `{"type":"string","minLength":40}`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			codec := loadTestCodec(t, tc.kind, tc.file, tc.schema, tc.msg)
+			rng := rand.New(rand.NewSource(1))
+			for i := 0; i < 200; i++ {
+				value, err := codec.encode(rng)
+				if err != nil {
+					t.Fatalf("encode: %v", err)
+				}
+				if err := codec.validate(context.Background(), value); err != nil {
+					t.Fatalf("validate %q: %v", value, err)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeAvroRejects(t *testing.T) {
+	schema, err := avro.Parse(`{"type":"record","name":"R","fields":[{"name":"e","type":{"type":"enum","name":"E","symbols":["A","B"]}},{"name":"u","type":["null","string"]}]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid, err := avro.Marshal(schema, map[string]any{"e": "B", "u": map[string]any{"string": "hi"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := decodeAvro(schema, valid); err != nil {
+		t.Fatalf("decode valid record: %v", err)
+	}
+	cases := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{name: "truncated", data: valid[:len(valid)-1], want: "EOF"},
+		{name: "trailing bytes", data: append(append([]byte(nil), valid...), 0), want: "trailing bytes"},
+		{name: "enum index out of range", data: []byte{0x04, 0x00}, want: "enum"},
+		{name: "union index out of range", data: []byte{0x00, 0x04}, want: "union"},
+		{name: "invalid utf-8", data: []byte{0x00, 0x02, 0x02, 0xff}, want: "invalid utf-8"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := decodeAvro(schema, tc.data)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("error = %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestSchemaCodecRejectsUnsatisfiableJSON(t *testing.T) {
+	cases := []struct {
+		name   string
+		schema string
+		want   string
+	}{
+		{name: "no integer in range", schema: `{"type":"integer","minimum":1.5,"maximum":1.7}`, want: "no integer between"},
+		{name: "exclusive bounds meet", schema: `{"type":"integer","exclusiveMinimum":1,"exclusiveMaximum":2}`, want: "no integer between"},
+		{name: "empty number range", schema: `{"type":"number","minimum":2,"maximum":1}`, want: "no number between"},
+		{name: "nested empty range", schema: `{"type":"object","properties":{"n":{"type":"integer","minimum":3,"maximum":2}}}`, want: "$.n"},
+		{name: "lengths cross", schema: `{"type":"string","minLength":5,"maxLength":2}`, want: "below minLength"},
+		{name: "bad pattern", schema: `{"type":"string","pattern":"(["}`, want: "invalid pattern"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "schema.json")
+			if err := os.WriteFile(path, []byte(tc.schema), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			spec := &scenario.SchemaSpec{Type: "json", File: path}
+			_, err := newSchemaCodec(context.Background(), spec, "", "topic", "run")
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("error = %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidateJSONExclusiveBounds(t *testing.T) {
+	cases := []struct {
+		name   string
+		schema map[string]any
+		value  float64
+		valid  bool
+	}{
+		{name: "above exclusive minimum", schema: map[string]any{"exclusiveMinimum": 1.0}, value: 1.5, valid: true},
+		{name: "at exclusive minimum", schema: map[string]any{"exclusiveMinimum": 1.0}, value: 1},
+		{name: "at exclusive maximum", schema: map[string]any{"exclusiveMaximum": 1.0}, value: 1},
+		{name: "at draft4 exclusive minimum", schema: map[string]any{"minimum": 1.0, "exclusiveMinimum": true}, value: 1},
+		{name: "at draft4 exclusive maximum", schema: map[string]any{"maximum": 1.0, "exclusiveMaximum": true}, value: 1},
+		{name: "at inclusive maximum", schema: map[string]any{"maximum": 1.0, "exclusiveMaximum": false}, value: 1, valid: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateJSON(tc.schema, tc.value, "$")
+			if (err == nil) != tc.valid {
+				t.Fatalf("validateJSON(%v) = %v, valid %v", tc.value, err, tc.valid)
+			}
+		})
+	}
+}
+
+func loadTestCodec(t *testing.T, kind string, file string, schema string, msg string) *schemaCodec {
+	t.Helper()
+	if schema != "" {
+		file = filepath.Join(t.TempDir(), "schema.json")
+		if err := os.WriteFile(file, []byte(schema), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	spec := &scenario.SchemaSpec{Type: kind, File: file, Message: msg}
+	codec, err := newSchemaCodec(context.Background(), spec, "", "topic", "run")
+	if err != nil {
+		t.Fatalf("load %s schema: %v", kind, err)
+	}
+	return codec
+}
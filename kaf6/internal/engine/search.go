@@ -0,0 +1,314 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package engine
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"kaf6/internal/metrics"
+	"kaf6/internal/scenario"
+)
+
+const (
+	defaultStepDuration     = 10 * time.Second
+	defaultSearchCooldown   = 2 * time.Second
+	defaultMaxProbes        = 10
+	defaultMinAchievedRatio = 0.95
+)
+
+// SearchResult is the outcome of a saturation search. SustainableRate is the
+// highest probed rate that met the SLO; Probes holds every probe sorted by
+// rate, which is the latency-vs-throughput curve.
+type SearchResult struct {
+	MinRate         float64
+	MaxRate         float64
+	Resolution      float64
+	StepDuration    time.Duration
+	SLO             scenario.SearchSLO
+	SustainableRate float64
+	Found           bool
+	Probes          []SearchProbe
+	Groups          []string `json:"-"`
+	Status          string
+}
+
+type SearchProbe struct {
+	Order      int
+	Rate       float64
+	Achieved   float64
+	Produced   int64
+	Consumed   int64
+	Errors     int64
+	ProduceP   metrics.Percentiles
+	CorrectedP metrics.Percentiles
+	EndToEndP  metrics.Percentiles
+	Failures   []string
+	Status     string
+}
+
+// runSearch binary-searches the offered rate between min_rate and max_rate.
+// Both bounds are probed first: a failing min_rate ends the search without a
+// result and a passing max_rate ends it at max_rate. After that every probe
+// halves the interval between the best passing and the lowest failing rate
+// until it is narrower than the resolution or max_probes is reached.
+func runSearch(ctx context.Context, spec *scenario.ScenarioFile, sum *metrics.Summary, runID string, verbose bool) (*SearchResult, error) {
+	cfg := spec.Scenarios.Search
+	if cfg.Producer == nil {
+		return nil, fmt.Errorf("search needs a producer")
+	}
+	if cfg.MinRate <= 0 || cfg.MaxRate < cfg.MinRate {
+		return nil, fmt.Errorf("search needs 0 < min_rate <= max_rate")
+	}
+	stepDuration := defaultStepDuration
+	if cfg.StepDuration != "" {
+		parsed, err := time.ParseDuration(cfg.StepDuration)
+		if err != nil {
+			return nil, fmt.Errorf("search step_duration: %w", err)
+		}
+		stepDuration = parsed
+	}
+	cooldown := defaultSearchCooldown
+	if cfg.Cooldown != "" {
+		parsed, err := time.ParseDuration(cfg.Cooldown)
+		if err != nil {
+			return nil, fmt.Errorf("search cooldown: %w", err)
+		}
+		cooldown = parsed
+	}
+	resolution := cfg.Resolution
+	if resolution <= 0 {
+		resolution = max(1, cfg.MaxRate/100)
+	}
+	maxProbes := cfg.MaxProbes
+	if maxProbes <= 0 {
+		maxProbes = defaultMaxProbes
+	}
+	slo := cfg.SLO
+	if slo.MinAchievedRatio <= 0 {
+		slo.MinAchievedRatio = defaultMinAchievedRatio
+	}
+	out := &SearchResult{
+		MinRate:      cfg.MinRate,
+		MaxRate:      cfg.MaxRate,
+		Resolution:   resolution,
+		StepDuration: stepDuration,
+		SLO:          slo,
+		Status:       "fail",
+	}
+	defer func() {
+		sort.Slice(out.Probes, func(i, j int) bool { return out.Probes[i].Rate < out.Probes[j].Rate })
+		if out.Found {
+			out.Status = "pass"
+		}
+	}()
+
+	probe := func(rate float64) (bool, error) {
+		if len(out.Probes) > 0 {
+			if err := sleepContext(ctx, cooldown); err != nil {
+				return false, err
+			}
+		}
+		order := len(out.Probes) + 1
+		if verbose {
+			fmt.Printf("search: probe %d at %.1f records/s\n", order, rate)
+		}
+		result, err := runProbe(ctx, spec, cfg, slo, sum, runID, order, rate, stepDuration, out)
+		if err != nil {
+			return false, err
+		}
+		if verbose {
+			fmt.Printf("search: probe %d achieved %.1f records/s, %s %s\n", order, result.Achieved, result.Status, strings.Join(result.Failures, "; "))
+		}
+		out.Probes = append(out.Probes, *result)
+		return result.Status == "pass", nil
+	}
+
+	sustainable, found, err := bisectRate(cfg.MinRate, cfg.MaxRate, resolution, maxProbes, probe)
+	out.SustainableRate, out.Found = sustainable, found
+	return out, err
+}
+
+// bisectRate runs the search itself: probe reports whether a rate met the
+// SLO. It returns the highest passing rate and whether any rate passed.
+func bisectRate(minRate float64, maxRate float64, resolution float64, maxProbes int, probe func(rate float64) (bool, error)) (float64, bool, error) {
+	passed, err := probe(minRate)
+	if err != nil || !passed {
+		return 0, false, err
+	}
+	sustainable := minRate
+	if maxRate == minRate {
+		return sustainable, true, nil
+	}
+	failing := maxRate
+	passed, err = probe(failing)
+	if err != nil {
+		return sustainable, true, err
+	}
+	if passed {
+		return failing, true, nil
+	}
+	for probes := 2; probes < maxProbes && failing-sustainable > resolution; probes++ {
+		rate := (sustainable + failing) / 2
+		passed, err := probe(rate)
+		if err != nil {
+			return sustainable, true, err
+		}
+		if passed {
+			sustainable = rate
+		} else {
+			failing = rate
+		}
+	}
+	return sustainable, true, nil
+}
+
+// searchBudget is how long a search may take: every probe's step, cooldown
+// and consumer timeout. Without a consumer a probe gets the same 30s of
+// slack the consumer timeout defaults to.
+func searchBudget(cfg *scenario.SearchScenario) time.Duration {
+	stepDuration := durationOr(cfg.StepDuration, defaultStepDuration)
+	cooldown := durationOr(cfg.Cooldown, defaultSearchCooldown)
+	maxProbes := cfg.MaxProbes
+	if maxProbes <= 0 {
+		maxProbes = defaultMaxProbes
+	}
+	timeout := stepDuration + 30*time.Second
+	if cfg.Consumer != nil {
+		timeout = durationOr(cfg.Consumer.Timeout, timeout)
+	}
+	return time.Duration(maxProbes) * (stepDuration + cooldown + timeout)
+}
+
+// runProbe runs the search producer at one rate for step_duration worth of
+// records, with the search consumer reading them concurrently from a fresh
+// group. Each probe keeps its own summary; only its record counts are added
+// to the scenario, since errors are expected once the rate is too high.
+func runProbe(ctx context.Context, spec *scenario.ScenarioFile, cfg *scenario.SearchScenario, slo scenario.SearchSLO, sum *metrics.Summary, runID string, order int, rate float64, stepDuration time.Duration, search *SearchResult) (*SearchProbe, error) {
+	producer := *cfg.Producer
+	producer.RatePerS = rate
+	producer.Messages = max(1, int(math.Round(rate*stepDuration.Seconds())))
+	probeSpec := *spec
+	probeSpec.Scenarios = scenario.ScenarioCollection{Producer: &producer}
+	if cfg.Consumer != nil {
+		consumer := *cfg.Consumer
+		consumer.Offset = "after_produce_start"
+		consumer.Until = "limit"
+		consumer.Limit = producer.Messages
+		consumer.Resume = false
+		consumer.Group.ID = probeGroupID(cfg.Consumer.Group.ID, order)
+		if consumer.Timeout == "" {
+			consumer.Timeout = (stepDuration + 30*time.Second).String()
+		}
+		if consumer.Mode != "partition" && strings.Contains(consumer.Group.ID, "{{run_id}}") {
+			search.Groups = append(search.Groups, resolvedGroupID(consumer.Group.ID, runID))
+		}
+		probeSpec.Scenarios.Consumer = &consumer
+	}
+
+	probeSum := &metrics.Summary{}
+	produced := &produceLog{start: time.Now()}
+	consumerCtx, stopConsumer := context.WithCancel(ctx)
+	defer stopConsumer()
+	var wg sync.WaitGroup
+	var consumerErr error
+	if probeSpec.Scenarios.Consumer != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, consumerErr = runConsumer(consumerCtx, &probeSpec, probeSum, runID, produced, nil)
+		}()
+	}
+	stats, err := runProducer(ctx, &probeSpec, probeSum, runID, produced)
+	if err != nil {
+		// The records the consumer waits for will never come.
+		stopConsumer()
+	}
+	wg.Wait()
+	sum.AddTotals(probeSum.Produced, probeSum.Consumed)
+	if err != nil {
+		// A producer that cannot run at this rate, for example one whose
+		// schedule no longer fits the deadline, fails the probe rather
+		// than the search.
+		return &SearchProbe{
+			Order:    order,
+			Rate:     rate,
+			Produced: probeSum.Produced,
+			Consumed: probeSum.Consumed,
+			Errors:   probeSum.Errors + 1,
+			Failures: []string{fmt.Sprintf("producer: %v", err)},
+			Status:   "fail",
+		}, nil
+	}
+
+	result := &SearchProbe{
+		Order:      order,
+		Rate:       rate,
+		Achieved:   stats.RecordsPerSecond,
+		Produced:   probeSum.Produced,
+		Consumed:   probeSum.Consumed,
+		Errors:     probeSum.Errors,
+		ProduceP:   metrics.LatencyPercentiles(probeSum.ProduceLatencies),
+		CorrectedP: metrics.LatencyPercentiles(probeSum.ProduceCorrected),
+		EndToEndP:  metrics.LatencyPercentiles(probeSum.EndToEndLatencies),
+		Status:     "pass",
+	}
+	if result.Errors > slo.MaxErrors {
+		result.Failures = append(result.Failures, fmt.Sprintf("%d errors, allowed %d", result.Errors, slo.MaxErrors))
+	}
+	if result.Achieved < rate*slo.MinAchievedRatio {
+		result.Failures = append(result.Failures, fmt.Sprintf("achieved %.1f/s, below %.0f%% of offered", result.Achieved, slo.MinAchievedRatio*100))
+	}
+	if slo.ProduceP99Ms > 0 && result.CorrectedP.P99 > slo.ProduceP99Ms {
+		result.Failures = append(result.Failures, fmt.Sprintf("produce p99 %.2fms above %.2fms", result.CorrectedP.P99, slo.ProduceP99Ms))
+	}
+	if probeSpec.Scenarios.Consumer != nil {
+		if consumerErr != nil {
+			result.Failures = append(result.Failures, fmt.Sprintf("consumer: %v", consumerErr))
+		}
+		if result.Consumed < result.Produced {
+			result.Failures = append(result.Failures, fmt.Sprintf("consumed %d of %d", result.Consumed, result.Produced))
+		}
+		if slo.EndToEndP99Ms > 0 && result.EndToEndP.P99 > slo.EndToEndP99Ms {
+			result.Failures = append(result.Failures, fmt.Sprintf("end-to-end p99 %.2fms above %.2fms", result.EndToEndP.P99, slo.EndToEndP99Ms))
+		}
+	}
+	if len(result.Failures) > 0 {
+		result.Status = "fail"
+	}
+	return result, nil
+}
+
+// probeGroupID gives every probe its own group, keeping {{run_id}} at the end
+// so that run-scoped groups stay recognisable to gc.
+func probeGroupID(template string, order int) string {
+	suffix := fmt.Sprintf("p%d", order)
+	switch {
+	case template == "" || template == "{{run_id}}":
+		return "kaf6-group-" + suffix + "-{{run_id}}"
+	case strings.Contains(template, "{{run_id}}"):
+		return strings.Replace(template, "{{run_id}}", suffix+"-{{run_id}}", 1)
+	default:
+		return template + "-" + suffix
+	}
+}
@@ -0,0 +1,112 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package engine
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"kaf6/internal/scenario"
+)
+
+func TestBisectRate(t *testing.T) {
+	cases := []struct {
+		name        string
+		min, max    float64
+		resolution  float64
+		maxProbes   int
+		capacity    float64
+		sustainable float64
+		found       bool
+		probes      []float64
+	}{
+		{name: "min fails", min: 100, max: 1000, resolution: 10, maxProbes: 10, capacity: 50, probes: []float64{100}},
+		{name: "max passes", min: 100, max: 1000, resolution: 10, maxProbes: 10, capacity: 5000, sustainable: 1000, found: true, probes: []float64{100, 1000}},
+		{name: "single rate", min: 100, max: 100, resolution: 10, maxProbes: 10, capacity: 500, sustainable: 100, found: true, probes: []float64{100}},
+		{
+			name: "bisects to resolution", min: 0, max: 800, resolution: 100, maxProbes: 10, capacity: 500,
+			sustainable: 500, found: true, probes: []float64{0, 800, 400, 600, 500},
+		},
+		{
+			name: "stops at max probes", min: 0, max: 800, resolution: 1, maxProbes: 4, capacity: 500,
+			sustainable: 400, found: true, probes: []float64{0, 800, 400, 600},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var probes []float64
+			sustainable, found, err := bisectRate(tc.min, tc.max, tc.resolution, tc.maxProbes, func(rate float64) (bool, error) {
+				probes = append(probes, rate)
+				return rate <= tc.capacity, nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sustainable != tc.sustainable || found != tc.found {
+				t.Errorf("sustainable=%v found=%v, want %v %v", sustainable, found, tc.sustainable, tc.found)
+			}
+			if !reflect.DeepEqual(probes, tc.probes) {
+				t.Errorf("probes = %v, want %v", probes, tc.probes)
+			}
+		})
+	}
+}
+
+func TestBisectRateKeepsResultOnError(t *testing.T) {
+	stop := errors.New("deadline")
+	sustainable, found, err := bisectRate(100, 1000, 10, 10, func(rate float64) (bool, error) {
+		if rate > 100 {
+			return false, stop
+		}
+		return true, nil
+	})
+	if !errors.Is(err, stop) || !found || sustainable != 100 {
+		t.Fatalf("sustainable=%v found=%v err=%v", sustainable, found, err)
+	}
+}
+
+func TestProbeGroupID(t *testing.T) {
+	cases := []struct {
+		template string
+		want     string
+	}{
+		{template: "", want: "kaf6-group-p3-{{run_id}}"},
+		{template: "{{run_id}}", want: "kaf6-group-p3-{{run_id}}"},
+		{template: "capacity-{{run_id}}", want: "capacity-p3-{{run_id}}"},
+		{template: "capacity-{{run_id}}-x", want: "capacity-p3-{{run_id}}-x"},
+		{template: "fixed", want: "fixed-p3"},
+	}
+	for _, tc := range cases {
+		if got := probeGroupID(tc.template, 3); got != tc.want {
+			t.Errorf("probeGroupID(%q) = %q, want %q", tc.template, got, tc.want)
+		}
+	}
+}
+
+func TestSearchBudget(t *testing.T) {
+	cfg := &scenario.SearchScenario{MaxProbes: 4, StepDuration: "20s", Cooldown: "5s"}
+	if got, want := searchBudget(cfg), 4*(20*time.Second+5*time.Second+50*time.Second); got != want {
+		t.Fatalf("budget without consumer = %s, want %s", got, want)
+	}
+	cfg.Consumer = &scenario.ConsumerScenario{Timeout: "2m"}
+	if got, want := searchBudget(cfg), 4*(20*time.Second+5*time.Second+2*time.Minute); got != want {
+		t.Fatalf("budget with consumer = %s, want %s", got, want)
+	}
+}
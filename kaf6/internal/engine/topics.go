@@ -0,0 +1,297 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"kaf6/internal/metrics"
+	"kaf6/internal/scenario"
+)
+
+const (
+	topicReadyTimeout = 30 * time.Second
+	topicPollInterval = 200 * time.Millisecond
+)
+
+type TopicResult struct {
+	Name              string
+	Partitions        int32
+	ReplicationFactor int
+	Existed           bool
+	DeleteLatency     time.Duration
+	CreateLatency     time.Duration
+	Configs           []TopicConfigCheck
+}
+
+// TopicConfigCheck compares a requested topic config with what
+// DescribeConfigs reports after creation. Status is "applied" when the
+// values match, "ignored" when the broker kept another value and "missing"
+// when the broker does not report the key at all.
+type TopicConfigCheck struct {
+	Key    string
+	Want   string
+	Got    string
+	Source string
+	Status string
+}
+
+// ensureTopics creates the scenario topics and waits until the metadata shows
+// every partition with a leader. Recreated topics are deleted first, and the
+// delete has to be visible in the metadata before the topic is created again.
+func ensureTopics(ctx context.Context, spec *scenario.ScenarioFile, sum *metrics.Summary, runID string, verbose bool) ([]TopicResult, error) {
+	if len(spec.Topics) == 0 {
+		return nil, nil
+	}
+	client, err := kgo.NewClient(kgo.SeedBrokers(spec.Brokers...))
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	admin := kadm.NewClient(client)
+
+	var results []TopicResult
+	for _, topic := range spec.Topics {
+		name := resolveTopic(topic.Name, nil, runID)
+		if name == "" {
+			continue
+		}
+		result := TopicResult{Name: name}
+		partitions := topic.Partitions
+		if partitions <= 0 {
+			partitions = 1
+		}
+		replication := topic.ReplicationFactor
+		if replication == 0 {
+			replication = 1
+		}
+		if topic.Recreate {
+			if verbose {
+				fmt.Printf("topic: deleting %s\n", name)
+			}
+			start := time.Now()
+			if err := deleteTopic(ctx, admin, name); err != nil {
+				return results, err
+			}
+			result.DeleteLatency = time.Since(start)
+		}
+		if verbose {
+			fmt.Printf("topic: creating %s (partitions=%d)\n", name, partitions)
+		}
+		start := time.Now()
+		existed, err := createTopic(ctx, admin, name, partitions, replication, topic.Configs, topic.Recreate)
+		if err != nil {
+			return results, err
+		}
+		result.Existed = existed
+		// An existing topic keeps its own partition count; only a topic we
+		// created has to show the requested one.
+		want := partitions
+		if existed {
+			want = 0
+		}
+		detail, err := waitTopicReady(ctx, admin, name, want)
+		if err != nil {
+			return results, err
+		}
+		result.CreateLatency = time.Since(start)
+		result.Partitions = int32(len(detail.Partitions))
+		result.ReplicationFactor = detail.Partitions.NumReplicas()
+		if replication > 0 && result.ReplicationFactor != int(replication) && !existed {
+			return results, fmt.Errorf("topic %s has replication factor %d, requested %d", name, result.ReplicationFactor, replication)
+		}
+		if len(topic.Configs) > 0 {
+			result.Configs, err = verifyTopicConfigs(ctx, admin, name, topic.Configs)
+			if err != nil {
+				return results, err
+			}
+			for _, check := range result.Configs {
+				if check.Status != "applied" {
+					sum.AddConfigMismatch()
+					if verbose {
+						fmt.Printf("topic: %s config %s=%s %s (broker has %q)\n", name, check.Key, check.Want, check.Status, check.Got)
+					}
+				}
+			}
+		}
+		if verbose {
+			fmt.Printf("topic: %s ready (partitions=%d existed=%t latency=%s)\n", name, result.Partitions, existed, result.CreateLatency.Round(time.Millisecond))
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func deleteTopic(ctx context.Context, admin *kadm.Client, name string) error {
+	resp, err := admin.DeleteTopics(ctx, name)
+	if err != nil {
+		return fmt.Errorf("delete topic %s: %w", name, err)
+	}
+	if deleted, ok := resp[name]; ok && deleted.Err != nil && !errors.Is(deleted.Err, kerr.UnknownTopicOrPartition) {
+		return fmt.Errorf("delete topic %s: %w", name, deleted.Err)
+	}
+	return waitTopicGone(ctx, admin, name)
+}
+
+// waitTopicGone polls the metadata until a deleted topic is no longer listed.
+func waitTopicGone(ctx context.Context, admin *kadm.Client, name string) error {
+	deadline := time.Now().Add(topicReadyTimeout)
+	for {
+		topics, err := admin.ListTopics(ctx, name)
+		if err == nil {
+			detail, ok := topics[name]
+			if !ok || errors.Is(detail.Err, kerr.UnknownTopicOrPartition) {
+				return nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("delete topic %s: still present after %s", name, topicReadyTimeout)
+		}
+		if err := sleepContext(ctx, topicPollInterval); err != nil {
+			return err
+		}
+	}
+}
+
+// createTopic reports whether the topic already existed. When recreating, an
+// existing topic means the delete has not settled on every broker yet, so the
+// create is retried until the deadline.
+func createTopic(ctx context.Context, admin *kadm.Client, name string, partitions int32, replication int16, configs scenario.TopicConfigs, recreate bool) (bool, error) {
+	var requested map[string]*string
+	if len(configs) > 0 {
+		requested = make(map[string]*string, len(configs))
+		for key, value := range configs {
+			requested[key] = kadm.StringPtr(value)
+		}
+	}
+	deadline := time.Now().Add(topicReadyTimeout)
+	for {
+		resp, err := admin.CreateTopics(ctx, partitions, replication, requested, name)
+		if err != nil {
+			return false, fmt.Errorf("create topic %s: %w", name, err)
+		}
+		created := resp[name]
+		switch {
+		case created.Err == nil:
+			return false, nil
+		case errors.Is(created.Err, kerr.TopicAlreadyExists) && !recreate:
+			return true, nil
+		case errors.Is(created.Err, kerr.TopicAlreadyExists) && time.Now().Before(deadline):
+		default:
+			return false, fmt.Errorf("create topic %s: %w", name, created.Err)
+		}
+		if err := sleepContext(ctx, topicPollInterval); err != nil {
+			return false, err
+		}
+	}
+}
+
+// waitTopicReady polls the metadata until every partition has a leader and,
+// when want is set, the topic has that many partitions.
+func waitTopicReady(ctx context.Context, admin *kadm.Client, name string, want int32) (kadm.TopicDetail, error) {
+	deadline := time.Now().Add(topicReadyTimeout)
+	last := "no metadata"
+	for {
+		topics, err := admin.ListTopics(ctx, name)
+		if err != nil {
+			last = err.Error()
+		} else if detail, ok := topics[name]; !ok || detail.Err != nil {
+			last = "topic not in metadata"
+		} else if last = topicReadiness(detail, want); last == "" {
+			return detail, nil
+		}
+		if time.Now().After(deadline) {
+			return kadm.TopicDetail{}, fmt.Errorf("topic %s not ready after %s: %s", name, topicReadyTimeout, last)
+		}
+		if err := sleepContext(ctx, topicPollInterval); err != nil {
+			return kadm.TopicDetail{}, err
+		}
+	}
+}
+
+// topicReadiness explains why a topic is not ready yet, or returns "" when
+// it has the wanted partition count and every partition has a leader.
+func topicReadiness(detail kadm.TopicDetail, want int32) string {
+	count := int32(len(detail.Partitions))
+	switch {
+	case count == 0:
+		return "no partitions"
+	case want > 0 && count != want:
+		return fmt.Sprintf("%d partitions, want %d", count, want)
+	}
+	for _, partition := range detail.Partitions {
+		if partition.Leader < 0 || partition.Err != nil {
+			return fmt.Sprintf("%d partitions, not all with a leader", count)
+		}
+	}
+	return ""
+}
+
+func verifyTopicConfigs(ctx context.Context, admin *kadm.Client, name string, configs scenario.TopicConfigs) ([]TopicConfigCheck, error) {
+	described, err := admin.DescribeTopicConfigs(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("describe configs %s: %w", name, err)
+	}
+	resource, err := described.On(name, nil)
+	if err == nil {
+		err = resource.Err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("describe configs %s: %w", name, err)
+	}
+	return compareTopicConfigs(configs, resource.Configs), nil
+}
+
+// compareTopicConfigs checks every requested config against the described
+// ones, in key order.
+func compareTopicConfigs(configs scenario.TopicConfigs, described []kadm.Config) []TopicConfigCheck {
+	actual := make(map[string]kadm.Config, len(described))
+	for _, config := range described {
+		actual[config.Key] = config
+	}
+	checks := make([]TopicConfigCheck, 0, len(configs))
+	for _, key := range sortedKeys(configs) {
+		check := TopicConfigCheck{Key: key, Want: configs[key], Status: "missing"}
+		if config, ok := actual[key]; ok {
+			check.Got = config.MaybeValue()
+			check.Source = config.Source.String()
+			check.Status = "applied"
+			if check.Got != check.Want {
+				check.Status = "ignored"
+			}
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
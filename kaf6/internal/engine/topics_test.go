@@ -0,0 +1,89 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package engine
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kmsg"
+
+	"kaf6/internal/scenario"
+)
+
+func TestTopicReadiness(t *testing.T) {
+	led := kadm.PartitionDetails{0: {Partition: 0, Leader: 1}, 1: {Partition: 1, Leader: 2}}
+	cases := []struct {
+		name   string
+		detail kadm.TopicDetail
+		want   int32
+		expect string
+	}{
+		{name: "ready", detail: kadm.TopicDetail{Partitions: led}, want: 2},
+		{name: "any partition count", detail: kadm.TopicDetail{Partitions: led}},
+		{name: "no partitions", detail: kadm.TopicDetail{}, want: 2, expect: "no partitions"},
+		{name: "count mismatch", detail: kadm.TopicDetail{Partitions: led}, want: 3, expect: "2 partitions, want 3"},
+		{
+			name:   "leaderless partition",
+			detail: kadm.TopicDetail{Partitions: kadm.PartitionDetails{0: {Leader: 1}, 1: {Partition: 1, Leader: -1}}},
+			want:   2,
+			expect: "2 partitions, not all with a leader",
+		},
+		{
+			name:   "partition error",
+			detail: kadm.TopicDetail{Partitions: kadm.PartitionDetails{0: {Leader: 1, Err: errors.New("leader not available")}}},
+			expect: "1 partitions, not all with a leader",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := topicReadiness(tc.detail, tc.want); got != tc.expect {
+				t.Fatalf("got %q, want %q", got, tc.expect)
+			}
+		})
+	}
+}
+
+func TestCompareTopicConfigs(t *testing.T) {
+	value := func(s string) *string { return &s }
+	configs := scenario.TopicConfigs{
+		"retention.ms":        "60000",
+		"cleanup.policy":      "compact",
+		"min.insync.replicas": "2",
+	}
+	described := []kadm.Config{
+		{Key: "retention.ms", Value: value("60000"), Source: kmsg.ConfigSourceDynamicTopicConfig},
+		{Key: "cleanup.policy", Value: value("delete"), Source: kmsg.ConfigSourceDefaultConfig},
+		{Key: "segment.bytes", Value: value("1024")},
+	}
+	want := []TopicConfigCheck{
+		{Key: "cleanup.policy", Want: "compact", Got: "delete", Source: kmsg.ConfigSourceDefaultConfig.String(), Status: "ignored"},
+		{Key: "min.insync.replicas", Want: "2", Status: "missing"},
+		{Key: "retention.ms", Want: "60000", Got: "60000", Source: kmsg.ConfigSourceDynamicTopicConfig.String(), Status: "applied"},
+	}
+	got := compareTopicConfigs(configs, described)
+	if len(got) != len(want) {
+		t.Fatalf("got %d checks, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("check %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
@@ -19,6 +19,7 @@ package metrics
 
 import (
 	"math"
+	"slices"
 	"sort"
 	"sync"
 	"time"
@@ -29,9 +30,27 @@ type Summary struct {
 	Consumed int64
 	Errors   int64
 
+	HeaderMismatches int64
+	SchemaErrors     int64
+	Rebalances       int64
+	CommitMismatches int64
+	Duplicates       int64
+	MaxLag           int64
+	ConfigMismatches int64
+	AdminFailures    int64
+	GroupFailures    int64
+	Corrupted        int64
+	ClockSkew        int64
+
 	ProduceLatencies []time.Duration
-	ConsumeLatencies []time.Duration
+	// ProduceCorrected measures produce latency from the intended send time
+	// of a paced producer instead of the actual one, so time spent waiting
+	// behind a slow send counts as latency.
+	ProduceCorrected     []time.Duration
+	ConsumeLatencies     []time.Duration
 	ConsumePollLatencies []time.Duration
+	EndToEndLatencies    []time.Duration
+	BrokerDeltas         []time.Duration
 
 	mu sync.Mutex
 }
@@ -45,6 +64,14 @@ func (s *Summary) AddProduce(lat time.Duration) {
 	}
 }
 
+func (s *Summary) AddProduceCorrected(lat time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if lat > 0 {
+		s.ProduceCorrected = append(s.ProduceCorrected, lat)
+	}
+}
+
 func (s *Summary) AddConsume(lat time.Duration) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -62,6 +89,95 @@ func (s *Summary) AddConsumePoll(lat time.Duration) {
 	}
 }
 
+// AddEndToEnd records the time from a record's embedded send time until it
+// was consumed. A negative value means the consumer clock is behind the
+// producer clock, so it is counted as clock skew instead.
+func (s *Summary) AddEndToEnd(lat time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if lat < 0 {
+		s.ClockSkew++
+		return
+	}
+	s.EndToEndLatencies = append(s.EndToEndLatencies, lat)
+}
+
+// AddBrokerDelta records the record timestamp minus its embedded send time.
+// It may be negative.
+func (s *Summary) AddBrokerDelta(delta time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.BrokerDeltas = append(s.BrokerDeltas, delta)
+}
+
+// AddTotals adds the record counts of a step that keeps its own summary.
+func (s *Summary) AddTotals(produced int64, consumed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Produced += produced
+	s.Consumed += consumed
+}
+
+func (s *Summary) AddHeaderMismatch() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.HeaderMismatches++
+}
+
+func (s *Summary) AddSchemaError() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.SchemaErrors++
+}
+
+func (s *Summary) AddRebalance() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Rebalances++
+}
+
+func (s *Summary) AddCommitMismatch() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.CommitMismatches++
+}
+
+func (s *Summary) AddDuplicate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Duplicates++
+}
+
+func (s *Summary) ObserveLag(lag int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.MaxLag = max(s.MaxLag, lag)
+}
+
+func (s *Summary) AddConfigMismatch() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ConfigMismatches++
+}
+
+func (s *Summary) AddAdminFailure() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.AdminFailures++
+}
+
+func (s *Summary) AddGroupFailure() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.GroupFailures++
+}
+
+func (s *Summary) AddCorrupt() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Corrupted++
+}
+
 func (s *Summary) AddError() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -72,6 +188,8 @@ type Percentiles struct {
 	P50 float64
 	P95 float64
 	P99 float64
+	// Count is the number of samples behind the percentiles.
+	Count int
 }
 
 func LatencyPercentiles(durations []time.Duration) Percentiles {
@@ -80,14 +198,47 @@ func LatencyPercentiles(durations []time.Duration) Percentiles {
 	}
 	values := make([]float64, 0, len(durations))
 	for _, d := range durations {
-		values = append(values, float64(d.Milliseconds()))
+		values = append(values, float64(d)/float64(time.Millisecond))
 	}
 	sort.Float64s(values)
 	return Percentiles{
-		P50: percentile(values, 0.50),
-		P95: percentile(values, 0.95),
-		P99: percentile(values, 0.99),
+		P50:   percentile(values, 0.50),
+		P95:   percentile(values, 0.95),
+		P99:   percentile(values, 0.99),
+		Count: len(values),
+	}
+}
+
+// HistogramBucket counts the samples above the previous bucket's bound and
+// up to UpperMs.
+type HistogramBucket struct {
+	UpperMs float64
+	Count   int
+}
+
+// LatencyHistogram buckets durations on a 1-2-5 millisecond scale, up to the
+// first bound that covers the slowest sample. Histograms of different sample
+// sets share their leading bounds, so they can be compared bucket by bucket.
+func LatencyHistogram(durations []time.Duration) []HistogramBucket {
+	if len(durations) == 0 {
+		return nil
+	}
+	slowest := float64(slices.Max(durations)) / float64(time.Millisecond)
+	var buckets []HistogramBucket
+	for scale := 1.0; len(buckets) == 0 || buckets[len(buckets)-1].UpperMs < slowest; scale *= 10 {
+		for _, step := range []float64{1, 2, 5} {
+			if len(buckets) > 0 && buckets[len(buckets)-1].UpperMs >= slowest {
+				break
+			}
+			buckets = append(buckets, HistogramBucket{UpperMs: step * scale})
+		}
+	}
+	for _, d := range durations {
+		ms := float64(d) / float64(time.Millisecond)
+		i := sort.Search(len(buckets), func(i int) bool { return buckets[i].UpperMs >= ms })
+		buckets[i].Count++
 	}
+	return buckets
 }
 
 func percentile(values []float64, p float64) float64 {
@@ -0,0 +1,220 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const contentType = "application/vnd.schemaregistry.v1+json"
+
+type Schema struct {
+	Subject    string `json:"subject,omitempty"`
+	Version    int    `json:"version,omitempty"`
+	ID         int    `json:"id,omitempty"`
+	Schema     string `json:"schema"`
+	SchemaType string `json:"schemaType,omitempty"`
+}
+
+type Server struct {
+	mu       sync.Mutex
+	byID     map[int]Schema
+	subjects map[string][]int
+	nextID   int
+	listener net.Listener
+	server   *http.Server
+}
+
+func Start() (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	srv := &Server{
+		byID:     make(map[int]Schema),
+		subjects: make(map[string][]int),
+		nextID:   1,
+		listener: listener,
+	}
+	srv.server = &http.Server{Handler: http.HandlerFunc(srv.handle), ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		_ = srv.server.Serve(listener)
+	}()
+	return srv, nil
+}
+
+func (s *Server) URL() string {
+	return "http://" + s.listener.Addr().String()
+}
+
+func (s *Server) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return s.server.Shutdown(ctx)
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.Method == http.MethodGet && len(parts) == 1 && parts[0] == "subjects":
+		s.mu.Lock()
+		subjects := make([]string, 0, len(s.subjects))
+		for subject := range s.subjects {
+			subjects = append(subjects, subject)
+		}
+		s.mu.Unlock()
+		writeJSON(w, http.StatusOK, subjects)
+	case r.Method == http.MethodPost && len(parts) == 3 && parts[0] == "subjects" && parts[2] == "versions":
+		var req Schema
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Schema == "" {
+			writeError(w, http.StatusUnprocessableEntity, 42201, "invalid schema")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]int{"id": s.register(parts[1], req)})
+	case r.Method == http.MethodGet && len(parts) == 4 && parts[0] == "subjects" && parts[2] == "versions":
+		schema, ok := s.version(parts[1], parts[3])
+		if !ok {
+			writeError(w, http.StatusNotFound, 40402, "version not found")
+			return
+		}
+		writeJSON(w, http.StatusOK, schema)
+	case r.Method == http.MethodGet && len(parts) == 3 && parts[0] == "schemas" && parts[1] == "ids":
+		id, err := strconv.Atoi(parts[2])
+		s.mu.Lock()
+		schema, ok := s.byID[id]
+		s.mu.Unlock()
+		if err != nil || !ok {
+			writeError(w, http.StatusNotFound, 40403, "schema not found")
+			return
+		}
+		writeJSON(w, http.StatusOK, Schema{Schema: schema.Schema, SchemaType: schema.SchemaType})
+	default:
+		writeError(w, http.StatusNotFound, 404, "not found")
+	}
+}
+
+func (s *Server) register(subject string, req Schema) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range s.subjects[subject] {
+		existing := s.byID[id]
+		if existing.Schema == req.Schema && existing.SchemaType == req.SchemaType {
+			return id
+		}
+	}
+	for id, existing := range s.byID {
+		if existing.Schema == req.Schema && existing.SchemaType == req.SchemaType {
+			s.subjects[subject] = append(s.subjects[subject], id)
+			return id
+		}
+	}
+	id := s.nextID
+	s.nextID++
+	s.byID[id] = Schema{ID: id, Schema: req.Schema, SchemaType: req.SchemaType}
+	s.subjects[subject] = append(s.subjects[subject], id)
+	return id
+}
+
+func (s *Server) version(subject string, version string) (Schema, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := s.subjects[subject]
+	if len(ids) == 0 {
+		return Schema{}, false
+	}
+	idx := len(ids) - 1
+	if version != "latest" {
+		n, err := strconv.Atoi(version)
+		if err != nil || n < 1 || n > len(ids) {
+			return Schema{}, false
+		}
+		idx = n - 1
+	}
+	schema := s.byID[ids[idx]]
+	schema.Subject = subject
+	schema.Version = idx + 1
+	return schema, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, payload any) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(payload)
+}
+
+func writeError(w http.ResponseWriter, status int, code int, message string) {
+	writeJSON(w, status, map[string]any{"error_code": code, "message": message})
+}
+
+type Client struct {
+	url  string
+	http *http.Client
+}
+
+func NewClient(url string) *Client {
+	return &Client{url: strings.TrimRight(url, "/"), http: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (c *Client) Register(ctx context.Context, subject string, schema string, schemaType string) (int, error) {
+	body, err := json.Marshal(Schema{Schema: schema, SchemaType: schemaType})
+	if err != nil {
+		return 0, err
+	}
+	var out struct {
+		ID int `json:"id"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/subjects/"+subject+"/versions", body, &out); err != nil {
+		return 0, fmt.Errorf("register subject %s: %w", subject, err)
+	}
+	return out.ID, nil
+}
+
+func (c *Client) SchemaByID(ctx context.Context, id int) (Schema, error) {
+	var out Schema
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/schemas/ids/%d", id), nil, &out); err != nil {
+		return Schema{}, fmt.Errorf("fetch schema %d: %w", id, err)
+	}
+	out.ID = id
+	return out, nil
+}
+
+func (c *Client) do(ctx context.Context, method string, path string, body []byte, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.url+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("registry status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,154 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"kaf6/internal/engine"
+)
+
+func WriteAudit(audit *engine.AuditResult, root string) (string, string, error) {
+	if root == "" {
+		root = "reports"
+	}
+	dir := filepath.Join(root, audit.ID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", "", err
+	}
+	jsonPath := filepath.Join(dir, "audit.json")
+	payload, err := json.MarshalIndent(audit, "", "  ")
+	if err != nil {
+		return "", "", err
+	}
+	if err := os.WriteFile(jsonPath, payload, 0o644); err != nil {
+		return "", "", err
+	}
+	htmlPath := filepath.Join(dir, "audit.html")
+	if err := os.WriteFile(htmlPath, []byte(renderAudit(audit)), 0o644); err != nil {
+		return "", "", err
+	}
+	return jsonPath, htmlPath, nil
+}
+
+func renderAudit(audit *engine.AuditResult) string {
+	label, icon, statusClass := statusBadge(audit.Status)
+	cardClass := "card status"
+	if audit.Status != "pass" {
+		cardClass += " fail"
+	}
+	partitions := ""
+	for _, partition := range audit.Partitions {
+		partitions += fmt.Sprintf(`<tr><td>%d</td><td>%d</td><td>%d</td><td>%s</td><td>%s</td><td>%d</td><td>%d</td></tr>`,
+			partition.Partition,
+			partition.Start,
+			partition.End,
+			auditOffset(partition.First),
+			auditOffset(partition.Last),
+			partition.Records,
+			partition.Gaps,
+		)
+	}
+	problems := ""
+	for _, problem := range audit.Problems {
+		problems += fmt.Sprintf(`<tr><td>%d</td><td>%d</td><td>%s</td><td>%s</td></tr>`,
+			problem.Partition,
+			problem.Offset,
+			problem.Kind,
+			displayOrNA(problem.Detail),
+		)
+	}
+	if problems == "" {
+		problems = `<tr><td colspan="4" class="na">No problems found.</td></tr>`
+	}
+	title := fmt.Sprintf("KAF6 Audit %s", audit.Topic)
+	return fmt.Sprintf(`<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8"/>
+<title>%s</title>
+%s
+</head>
+<body>
+<h1>%s</h1>
+<div class="meta">Started: %s</div>
+<div class="meta">Duration: %s</div>
+<div class="%s">
+<h3>Audit</h3>
+<dl>
+<dt>Status</dt><dd class="%s">%s %s</dd>
+<dt>Brokers</dt><dd>%v</dd>
+<dt>Range</dt><dd>%s</dd>
+<dt>Cleanup Policy</dt><dd>%s</dd>
+<dt>Timestamp Type</dt><dd>%s</dd>
+<dt>Records</dt><dd>%d (%d control records)</dd>
+<dt>Gaps</dt><dd>%d (%d explained by compaction)</dd>
+<dt>Duplicate IDs</dt><dd>%d</dd>
+<dt>Timestamp Violations</dt><dd>%d</dd>
+<dt>Checksums</dt><dd>%d checked, %d failed</dd>
+<dt>Unread Offsets</dt><dd>%d</dd>
+</dl>
+</div>
+<h2>Partitions</h2>
+<table>
+  <tr><th>Partition</th><th>Start</th><th>End</th><th>First Read</th><th>Last Read</th><th>Records</th><th>Gaps</th></tr>
+  %s
+</table>
+<h2>Problems</h2>
+<table>
+  <tr><th>Partition</th><th>Offset</th><th>Problem</th><th>Detail</th></tr>
+  %s
+</table>
+</body>
+</html>`,
+		title,
+		reportStyle,
+		title,
+		formatTime(audit.StartedAt),
+		formatDuration(audit.Duration),
+		cardClass,
+		statusClass,
+		icon,
+		label,
+		audit.Brokers,
+		audit.Range,
+		displayOrNA(audit.CleanupPolicy),
+		displayOrNA(audit.TimestampType),
+		audit.Records,
+		audit.ControlRecords,
+		audit.Gaps,
+		audit.ExplainedGaps,
+		audit.Duplicates,
+		audit.TimestampViolations,
+		audit.Checksums,
+		audit.ChecksumFailures,
+		audit.Unread,
+		partitions,
+		problems,
+	)
+}
+
+func auditOffset(offset int64) string {
+	if offset < 0 {
+		return "n.a."
+	}
+	return fmt.Sprint(offset)
+}
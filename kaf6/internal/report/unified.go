@@ -26,6 +26,7 @@ import (
 	"time"
 
 	"kaf6/internal/engine"
+	"kaf6/internal/metrics"
 )
 
 type ReportData struct {
@@ -194,18 +195,11 @@ func profileKey(id string, name string) string {
 	return name
 }
 
-func writeUnifiedHTML(path string, data ReportData) error {
-	data = normalizeReportData(data)
-	content := fmt.Sprintf(`<!doctype html>
-<html lang="en">
-<head>
-<meta charset="utf-8"/>
-<title>%s</title>
-<style>
+const reportStyle = `<style>
 body{font-family:Arial,Helvetica,sans-serif;margin:24px;color:#111}
 h1{margin:0 0 8px 0}
 h2{margin:20px 0 8px 0}
-table{border-collapse:collapse;width:100%%;margin-top:12px}
+table{border-collapse:collapse;width:100%;margin-top:12px}
 th,td{border:1px solid #ddd;padding:8px;text-align:left;vertical-align:top}
 th{background:#f3f3f3}
 .ok{color:#0a7f2e;font-weight:bold}
@@ -225,7 +219,16 @@ th{background:#f3f3f3}
 .tab-btn.active{border-color:#111;background:#111;color:#fff}
 .tab-panel{display:none;margin-top:8px}
 .tab-panel.active{display:block}
-</style>
+</style>`
+
+func writeUnifiedHTML(path string, data ReportData) error {
+	data = normalizeReportData(data)
+	content := fmt.Sprintf(`<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8"/>
+<title>%s</title>
+%s
 </head>
 <body>
 <h1>%s</h1>
@@ -254,6 +257,7 @@ if (tabButtons.length > 0 && tabPanels.length > 0) {
 </body>
 </html>`,
 		data.Title,
+		reportStyle,
 		data.Title,
 		formatTime(data.StartedAt),
 		formatDuration(data.Duration),
@@ -408,7 +412,563 @@ func renderProfileSection(group ReportGroup) string {
   %s
 </table>`, rows)
 
-	return fmt.Sprintf(`<h2>Profile: %s</h2>%s%s%s%s`, renderProfileLabel(group.ProfileID, group.ProfileName), card, profileCard, errorCards, table)
+	return fmt.Sprintf(`<h2>Profile: %s</h2>%s%s%s%s%s%s%s%s%s%s%s%s%s`, renderProfileLabel(group.ProfileID, group.ProfileName), card, profileCard, errorCards, table, renderTopicTables(group), renderProducerTables(group), renderLatencyTables(group), renderSearchTables(group), renderConsumerTables(group), renderCompressionTables(group), renderDurabilityTables(group), renderAdminTables(group), renderGroupTables(group))
+}
+
+func renderTopicTables(group ReportGroup) string {
+	out := ""
+	for _, result := range group.Results {
+		if len(result.Topics) == 0 {
+			continue
+		}
+		rows := ""
+		for _, topic := range result.Topics {
+			setup := "created"
+			if topic.Existed {
+				setup = "existed"
+			}
+			rows += fmt.Sprintf(`<tr><td>%s</td><td>%d</td><td>%d</td><td>%s</td><td>%s</td><td>%s</td></tr>`,
+				topic.Name,
+				topic.Partitions,
+				topic.ReplicationFactor,
+				setup,
+				topic.DeleteLatency.Round(time.Millisecond),
+				topic.CreateLatency.Round(time.Millisecond),
+			)
+		}
+		out += fmt.Sprintf(`<h3>Topics: %s</h3>
+<table>
+  <tr><th>Topic</th><th>Partitions</th><th>Replication</th><th>Setup</th><th>Delete Latency</th><th>Ready Latency</th></tr>
+  %s
+</table>`, displayOrNA(result.Name), rows)
+		configRows := ""
+		for _, topic := range result.Topics {
+			for _, check := range topic.Configs {
+				statusClass := "ok"
+				if check.Status != "applied" {
+					statusClass = "bad"
+				}
+				configRows += fmt.Sprintf(`<tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td class="%s">%s</td></tr>`,
+					topic.Name,
+					check.Key,
+					check.Want,
+					displayOrNA(check.Got),
+					displayOrNA(check.Source),
+					statusClass,
+					check.Status,
+				)
+			}
+		}
+		if configRows != "" {
+			out += fmt.Sprintf(`<h3>Topic Configs: %s</h3>
+<table>
+  <tr><th>Topic</th><th>Config</th><th>Requested</th><th>Broker Value</th><th>Source</th><th>Status</th></tr>
+  %s
+</table>`, displayOrNA(result.Name), configRows)
+		}
+	}
+	return out
+}
+
+func renderConsumerTables(group ReportGroup) string {
+	out := ""
+	for _, result := range group.Results {
+		consumer := result.Consumer
+		if consumer == nil {
+			continue
+		}
+		if consumer.Balancer != "" || consumer.Protocol == "consumer" || consumer.ProtocolFallback || consumer.InstanceID != "" {
+			protocol := consumer.Protocol
+			if consumer.ProtocolFallback {
+				protocol += " (consumer protocol not advertised by the brokers)"
+			}
+			balancer := consumer.Balancer
+			if balancer == "" {
+				balancer = "default"
+			}
+			out += fmt.Sprintf(`<h3>Consumer Group: %s</h3>
+<table>
+  <tr><th>Protocol</th><th>Balancer</th><th>Instance ID</th></tr>
+  <tr><td>%s</td><td>%s</td><td>%s</td></tr>
+</table>`, displayOrNA(result.Name), protocol, balancer, displayOrNA(consumer.InstanceID))
+		}
+		if rows, moved := startOffsetRows(consumer.ResolvedOffsets, consumer.StartOffsets); len(consumer.ResolvedOffsets) > 0 && (consumer.StartMode != "earliest" || moved) {
+			out += fmt.Sprintf(`<h3>Consumer Start Offsets: %s (%s)</h3>
+<table>
+  <tr><th>Partition</th><th>Resolved</th><th>First Fetched</th></tr>
+  %s
+</table>`, displayOrNA(result.Name), consumer.StartMode, rows)
+		}
+		if len(consumer.Commits) > 0 && (consumer.Commit != "auto" || result.CommitMismatches > 0 || consumer.Resume != nil) {
+			rows := ""
+			for _, check := range consumer.Commits {
+				label, icon, statusClass := statusBadge(check.Status)
+				rows += fmt.Sprintf(`<tr><td>%d</td><td>%d</td><td>%d</td><td class="%s">%s %s</td></tr>`,
+					check.Partition,
+					check.Consumed,
+					check.Committed,
+					statusClass,
+					icon,
+					label,
+				)
+			}
+			if resume := consumer.Resume; resume != nil {
+				label, icon, statusClass := statusBadge(resume.Status)
+				rows += fmt.Sprintf(`<tr><td>resume</td><td colspan="2">consumed %d, duplicates %d, skipped %d</td><td class="%s">%s %s</td></tr>`,
+					resume.Consumed,
+					resume.Duplicates,
+					resume.Skipped,
+					statusClass,
+					icon,
+					label,
+				)
+			}
+			out += fmt.Sprintf(`<h3>Consumer Commits: %s (%s)</h3>
+<table>
+  <tr><th>Partition</th><th>Consumed Up To</th><th>Committed</th><th>Status</th></tr>
+  %s
+</table>`, displayOrNA(result.Name), consumer.Commit, rows)
+		}
+		if lag := consumer.Lag; lag != nil && lag.Max > 0 {
+			drain := "not drained"
+			if lag.Drained {
+				drain = lag.TimeToDrain.Round(time.Millisecond).String()
+			}
+			series := make([]string, len(lag.Samples))
+			for i, sample := range lag.Samples {
+				series[i] = fmt.Sprintf("%s: %d", sample.At.Round(time.Second), sample.Lag)
+			}
+			out += fmt.Sprintf(`<h3>Consumer Lag: %s</h3>
+<table>
+  <tr><th>Max Lag</th><th>Time To Drain</th><th>Samples (every %s)</th></tr>
+  <tr><td>%d</td><td>%s</td><td>%s</td></tr>
+</table>`, displayOrNA(result.Name), lag.Interval, lag.Max, drain, strings.Join(series, ", "))
+		}
+		if result.Rebalances > 0 {
+			rows := ""
+			for _, event := range consumer.Rebalances {
+				partitions := make([]string, len(event.Partitions))
+				for i, partition := range event.Partitions {
+					partitions[i] = fmt.Sprintf("%d", partition)
+				}
+				rows += fmt.Sprintf(`<tr><td>%s</td><td>%d</td><td>%s</td><td>%d</td><td>%s</td></tr>`,
+					event.Time.Format("15:04:05.000"),
+					event.Client,
+					event.Kind,
+					event.Generation,
+					displayOrNA(strings.Join(partitions, ", ")),
+				)
+			}
+			out += fmt.Sprintf(`<h3>Consumer Rebalances: %s (%d)</h3>
+<table>
+  <tr><th>Time</th><th>Client</th><th>Event</th><th>Generation</th><th>Partitions</th></tr>
+  %s
+</table>`, displayOrNA(result.Name), result.Rebalances, rows)
+		}
+		if len(consumer.Corrupt) > 0 {
+			rows := ""
+			for _, corrupt := range consumer.Corrupt {
+				rows += fmt.Sprintf(`<tr><td>%d</td><td>%d</td><td>%s</td><td>%s</td></tr>`,
+					corrupt.Partition,
+					corrupt.Offset,
+					corrupt.Expected,
+					corrupt.Actual,
+				)
+			}
+			out += fmt.Sprintf(`<h3>Corrupt Records: %s (%d)</h3>
+<table>
+  <tr><th>Partition</th><th>Offset</th><th>Embedded Checksum</th><th>Computed Checksum</th></tr>
+  %s
+</table>`, displayOrNA(result.Name), result.Corrupted, rows)
+		}
+		if len(consumer.Clients) < 2 {
+			continue
+		}
+		rows := ""
+		for _, client := range consumer.Clients {
+			partitions := make([]string, len(client.Partitions))
+			for i, partition := range client.Partitions {
+				partitions[i] = fmt.Sprintf("%d", partition)
+			}
+			rows += fmt.Sprintf(`<tr><td>%d</td><td>%s</td><td>%d</td><td>%s</td></tr>`,
+				client.Client,
+				displayOrNA(strings.Join(partitions, ", ")),
+				client.Consumed,
+				client.Idle.Round(time.Millisecond),
+			)
+		}
+		out += fmt.Sprintf(`<h3>Consumers: %s</h3>
+<table>
+  <tr><th>Client</th><th>Partitions</th><th>Consumed</th><th>Idle</th></tr>
+  %s
+</table>`, displayOrNA(result.Name), rows)
+	}
+	return out
+}
+
+func renderProducerTables(group ReportGroup) string {
+	out := ""
+	for _, result := range group.Results {
+		producer := result.Producer
+		if producer == nil {
+			continue
+		}
+		inFlight := "n.a."
+		if producer.InFlight > 0 {
+			inFlight = fmt.Sprintf("%d", producer.InFlight)
+		}
+		out += fmt.Sprintf(`<h3>Producer: %s</h3>
+<table>
+  <tr><th>Mode</th><th>In Flight</th><th>Linger</th><th>Acked</th><th>Duration</th><th>Records/s</th><th>Batches</th><th>Requests</th><th>Records/Batch (avg)</th><th>Records/Batch (max)</th><th>Batch Bytes (avg)</th><th>Records/Request (avg)</th></tr>
+  <tr><td>%s</td><td>%s</td><td>%s</td><td>%d</td><td>%s</td><td>%.1f</td><td>%d</td><td>%d</td><td>%.1f</td><td>%d</td><td>%.0f</td><td>%.1f</td></tr>
+</table>`, displayOrNA(result.Name),
+			producer.Mode,
+			inFlight,
+			producer.Linger,
+			producer.Acked,
+			producer.Duration.Round(time.Millisecond),
+			producer.RecordsPerSecond,
+			producer.Batches,
+			producer.Requests,
+			producer.AvgBatchRecords,
+			producer.MaxBatchRecords,
+			producer.AvgBatchBytes,
+			producer.AvgRecordsPerRequest,
+		)
+	}
+	return out
+}
+
+func renderLatencyTables(group ReportGroup) string {
+	out := ""
+	for _, result := range group.Results {
+		measurements := []struct {
+			name string
+			p    metrics.Percentiles
+		}{
+			{"Produce ack", result.ProduceP},
+			{"Produce ack from intended send time", result.ProduceCorrectedP},
+			{"End-to-end (send to consume)", result.EndToEndP},
+			{"Broker timestamp minus send time", result.BrokerDeltaP},
+			{"Record timestamp age", result.ConsumeP},
+			{"Consumer poll", result.ConsumePollP},
+		}
+		rows := ""
+		for _, measurement := range measurements {
+			if measurement.p.Count == 0 {
+				continue
+			}
+			rows += fmt.Sprintf(`<tr><td>%s</td><td>%d</td><td>%.2f</td><td>%.2f</td><td>%.2f</td></tr>`,
+				measurement.name,
+				measurement.p.Count,
+				measurement.p.P50,
+				measurement.p.P95,
+				measurement.p.P99,
+			)
+		}
+		if rows == "" {
+			continue
+		}
+		out += fmt.Sprintf(`<h3>Latency: %s</h3>
+<table>
+  <tr><th>Measurement</th><th>Samples</th><th>p50 (ms)</th><th>p95 (ms)</th><th>p99 (ms)</th></tr>
+  %s
+</table>`, displayOrNA(result.Name), rows)
+		out += renderCoordinatedOmission(result)
+		if result.Consumer == nil || len(result.Consumer.ClockSkew) == 0 {
+			continue
+		}
+		rows = ""
+		for _, skew := range result.Consumer.ClockSkew {
+			rows += fmt.Sprintf(`<tr><td>%s</td><td>%d</td><td>%s</td></tr>`,
+				skew.Producer,
+				skew.Records,
+				skew.MaxAhead.Round(time.Microsecond),
+			)
+		}
+		out += fmt.Sprintf(`<h3>Clock Skew: %s (%d)</h3>
+<table>
+  <tr><th>Producer</th><th>Records Consumed Before Send Time</th><th>Max Ahead</th></tr>
+  %s
+</table>`, displayOrNA(result.Name), result.ClockSkew, rows)
+	}
+	return out
+}
+
+// renderCoordinatedOmission compares produce latency measured from the actual
+// send with latency measured from the schedule of a paced producer. The gap is
+// the time records spent waiting behind slow sends.
+func renderCoordinatedOmission(result engine.Result) string {
+	raw, corrected := result.ProduceP, result.ProduceCorrectedP
+	if corrected.Count == 0 {
+		return ""
+	}
+	rows := ""
+	for _, row := range []struct {
+		name      string
+		raw       float64
+		corrected float64
+	}{
+		{"p50", raw.P50, corrected.P50},
+		{"p95", raw.P95, corrected.P95},
+		{"p99", raw.P99, corrected.P99},
+	} {
+		rows += fmt.Sprintf(`<tr><td>%s</td><td>%.2f</td><td>%.2f</td><td>%+.2f</td></tr>`, row.name, row.raw, row.corrected, row.corrected-row.raw)
+	}
+	out := fmt.Sprintf(`<h3>Coordinated Omission: %s</h3>
+<table>
+  <tr><th>Percentile</th><th>Raw (ms)</th><th>Corrected (ms)</th><th>Difference (ms)</th></tr>
+  %s
+</table>`, displayOrNA(result.Name), rows)
+
+	buckets := max(len(result.ProduceHistogram), len(result.CorrectedHistogram))
+	rows = ""
+	for i := 0; i < buckets; i++ {
+		var upper float64
+		var rawCount, correctedCount int
+		if i < len(result.ProduceHistogram) {
+			upper = result.ProduceHistogram[i].UpperMs
+			rawCount = result.ProduceHistogram[i].Count
+		}
+		if i < len(result.CorrectedHistogram) {
+			upper = result.CorrectedHistogram[i].UpperMs
+			correctedCount = result.CorrectedHistogram[i].Count
+		}
+		rows += fmt.Sprintf(`<tr><td>%g</td><td>%d</td><td>%d</td></tr>`, upper, rawCount, correctedCount)
+	}
+	out += fmt.Sprintf(`<h3>Produce Latency Histogram: %s</h3>
+<table>
+  <tr><th>Up To (ms)</th><th>Raw</th><th>Corrected</th></tr>
+  %s
+</table>`, displayOrNA(result.Name), rows)
+	return out
+}
+
+func renderSearchTables(group ReportGroup) string {
+	out := ""
+	for _, result := range group.Results {
+		search := result.Search
+		if search == nil {
+			continue
+		}
+		sustainable := "none"
+		if search.Found {
+			sustainable = fmt.Sprintf("%.1f records/s", search.SustainableRate)
+		}
+		var slo []string
+		if search.SLO.ProduceP99Ms > 0 {
+			slo = append(slo, fmt.Sprintf("produce p99 &le; %.2fms", search.SLO.ProduceP99Ms))
+		}
+		if search.SLO.EndToEndP99Ms > 0 {
+			slo = append(slo, fmt.Sprintf("end-to-end p99 &le; %.2fms", search.SLO.EndToEndP99Ms))
+		}
+		slo = append(slo, fmt.Sprintf("errors &le; %d", search.SLO.MaxErrors), fmt.Sprintf("achieved &ge; %.0f%%", search.SLO.MinAchievedRatio*100))
+		label, icon, statusClass := statusBadge(search.Status)
+		out += fmt.Sprintf(`<h3>Capacity Search: %s</h3>
+<table>
+  <tr><th>Sustainable Rate</th><th>Searched</th><th>Resolution</th><th>Step</th><th>SLO</th><th>Probes</th><th>Status</th></tr>
+  <tr><td>%s</td><td>%.1f-%.1f records/s</td><td>%.1f</td><td>%s</td><td>%s</td><td>%d</td><td class="%s">%s %s</td></tr>
+</table>`, displayOrNA(result.Name),
+			sustainable,
+			search.MinRate,
+			search.MaxRate,
+			search.Resolution,
+			search.StepDuration,
+			strings.Join(slo, ", "),
+			len(search.Probes),
+			statusClass,
+			icon,
+			label,
+		)
+		rows := ""
+		for _, probe := range search.Probes {
+			label, icon, statusClass := statusBadge(probe.Status)
+			rows += fmt.Sprintf(`<tr><td>%.1f</td><td>%.1f</td><td>%d</td><td>%d</td><td>%d</td><td>%.2f</td><td>%.2f</td><td>%.2f</td><td>%.2f</td><td class="%s">%s %s</td><td>%s</td><td>%d</td></tr>`,
+				probe.Rate,
+				probe.Achieved,
+				probe.Produced,
+				probe.Consumed,
+				probe.Errors,
+				probe.ProduceP.P50,
+				probe.ProduceP.P99,
+				probe.CorrectedP.P99,
+				probe.EndToEndP.P99,
+				statusClass,
+				icon,
+				label,
+				displayOrNA(strings.Join(probe.Failures, "; ")),
+				probe.Order,
+			)
+		}
+		out += fmt.Sprintf(`<h3>Latency vs Throughput: %s</h3>
+<table>
+  <tr><th>Offered (records/s)</th><th>Achieved (records/s)</th><th>Produced</th><th>Consumed</th><th>Errors</th><th>Produce p50 (ms)</th><th>Produce p99 (ms)</th><th>Corrected p99 (ms)</th><th>End-to-end p99 (ms)</th><th>Status</th><th>Failed SLO</th><th>Probe</th></tr>
+  %s
+</table>`, displayOrNA(result.Name), rows)
+	}
+	return out
+}
+
+func renderCompressionTables(group ReportGroup) string {
+	out := ""
+	for _, result := range group.Results {
+		if len(result.Compression) == 0 {
+			continue
+		}
+		rows := ""
+		for _, codec := range result.Compression {
+			label, icon, statusClass := statusBadge(codec.Status)
+			rows += fmt.Sprintf(`<tr><td>%s</td><td>%d</td><td>%s</td><td class="%s">%s %s</td><td>%d</td><td>%d</td><td>%d</td><td>%d</td><td>%d</td></tr>`,
+				codec.Codec,
+				codec.Partition,
+				displayOrNA(codec.StoredCodec),
+				statusClass,
+				icon,
+				label,
+				codec.Produced,
+				codec.Consumed,
+				codec.Mismatched,
+				codec.UncompressedBytes,
+				codec.CompressedBytes,
+			)
+		}
+		out += fmt.Sprintf(`<h3>Compression Matrix: %s</h3>
+<table>
+  <tr><th>Codec</th><th>Partition</th><th>Stored As</th><th>Status</th><th>Produced</th><th>Consumed</th><th>Mismatched</th><th>Uncompressed Bytes</th><th>Compressed Bytes</th></tr>
+  %s
+</table>`, displayOrNA(result.Name), rows)
+	}
+	return out
+}
+
+// startOffsetRows pairs each partition's resolved start offset with the
+// first offset its consumer fetched. moved reports whether any consumer
+// started somewhere else, as a group does from committed offsets.
+func startOffsetRows(resolved []engine.PartitionOffset, started []engine.PartitionOffset) (string, bool) {
+	fetched := make(map[int32]int64, len(started))
+	for _, start := range started {
+		fetched[start.Partition] = start.Offset
+	}
+	rows := ""
+	moved := false
+	for _, start := range resolved {
+		first := "none"
+		if offset, ok := fetched[start.Partition]; ok {
+			first = fmt.Sprintf("%d", offset)
+			moved = moved || offset != start.Offset
+		}
+		rows += fmt.Sprintf(`<tr><td>%d</td><td>%d</td><td>%s</td></tr>`, start.Partition, start.Offset, first)
+	}
+	return rows, moved
+}
+
+func renderDurabilityTables(group ReportGroup) string {
+	out := ""
+	for _, result := range group.Results {
+		durability := result.Durability
+		if durability == nil {
+			continue
+		}
+		label, icon, statusClass := statusBadge(durability.Status)
+		rows := fmt.Sprintf(`<tr><td>%s</td><td>%s</td><td>%d</td><td>%d</td><td>%d</td><td>%d</td><td>%d</td><td>%d</td><td class="%s">%s %s</td></tr>`,
+			durability.Topic,
+			durability.ProducedRunID,
+			durability.Expected,
+			durability.Found,
+			durability.Missing,
+			durability.Corrupted,
+			durability.Moved,
+			durability.Unread,
+			statusClass,
+			icon,
+			label,
+		)
+		out += fmt.Sprintf(`<h3>Durability: %s</h3>
+<p>Manifest: %s</p>
+<table>
+  <tr><th>Topic</th><th>Produced Run</th><th>Expected</th><th>Found</th><th>Missing</th><th>Corrupted</th><th>Moved</th><th>Unread</th><th>Status</th></tr>
+  %s
+</table>`, displayOrNA(result.Name), durability.Manifest, rows)
+		if len(durability.Problems) == 0 {
+			continue
+		}
+		problems := ""
+		for _, problem := range durability.Problems {
+			problems += fmt.Sprintf(`<tr><td>%s</td><td>%d</td><td>%d</td><td>%s</td><td>%s</td></tr>`,
+				problem.ID,
+				problem.Partition,
+				problem.Offset,
+				problem.Kind,
+				displayOrNA(problem.Detail),
+			)
+		}
+		out += fmt.Sprintf(`<table>
+  <tr><th>Record ID</th><th>Partition</th><th>Offset</th><th>Problem</th><th>Detail</th></tr>
+  %s
+</table>`, problems)
+	}
+	return out
+}
+
+func renderAdminTables(group ReportGroup) string {
+	out := ""
+	for _, result := range group.Results {
+		if len(result.Admin) == 0 {
+			continue
+		}
+		rows := ""
+		for _, step := range result.Admin {
+			label, icon, statusClass := statusBadge(step.Status)
+			rows += fmt.Sprintf(`<tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td class="%s">%s %s</td></tr>`,
+				step.Op,
+				displayOrNA(step.Topic),
+				step.Latency.Round(time.Millisecond),
+				displayOrNA(step.Detail),
+				displayOrNA(step.Error),
+				displayOrNA(strings.Join(step.Failures, "<br/>")),
+				statusClass,
+				icon,
+				label,
+			)
+		}
+		out += fmt.Sprintf(`<h3>Admin Steps: %s</h3>
+<table>
+  <tr><th>Op</th><th>Topic</th><th>Latency</th><th>Response</th><th>Error</th><th>Failed Expectations</th><th>Status</th></tr>
+  %s
+</table>`, displayOrNA(result.Name), rows)
+	}
+	return out
+}
+
+func renderGroupTables(group ReportGroup) string {
+	out := ""
+	for _, result := range group.Results {
+		if len(result.Groups) == 0 {
+			continue
+		}
+		rows := ""
+		for _, step := range result.Groups {
+			label, icon, statusClass := statusBadge(step.Status)
+			rows += fmt.Sprintf(`<tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td class="%s">%s %s</td></tr>`,
+				step.Op,
+				step.Group,
+				displayOrNA(step.Topic),
+				step.Latency.Round(time.Millisecond),
+				displayOrNA(step.Detail),
+				displayOrNA(step.Error),
+				displayOrNA(strings.Join(step.Failures, "<br/>")),
+				statusClass,
+				icon,
+				label,
+			)
+		}
+		out += fmt.Sprintf(`<h3>Group Steps: %s</h3>
+<table>
+  <tr><th>Op</th><th>Group</th><th>Topic</th><th>Latency</th><th>Response</th><th>Error</th><th>Failed Expectations</th><th>Status</th></tr>
+  %s
+</table>`, displayOrNA(result.Name), rows)
+	}
+	return out
 }
 
 func renderIssues(result engine.Result) string {
@@ -419,6 +979,47 @@ func renderIssues(result engine.Result) string {
 	if result.RunError != "" {
 		parts = append(parts, fmt.Sprintf("run: %s", result.RunError))
 	}
+	if result.HeaderMismatches > 0 {
+		parts = append(parts, fmt.Sprintf("headers: %d records with mismatched headers", result.HeaderMismatches))
+	}
+	if result.SchemaErrors > 0 {
+		parts = append(parts, fmt.Sprintf("schema: %d records failed validation", result.SchemaErrors))
+	}
+	if result.Corrupted > 0 {
+		parts = append(parts, fmt.Sprintf("corruption: %d records failed their checksum", result.Corrupted))
+	}
+	if search := result.Search; search != nil && !search.Found {
+		parts = append(parts, fmt.Sprintf("search: no rate from %.1f records/s met the SLO", search.MinRate))
+	}
+	if result.ClockSkew > 0 {
+		parts = append(parts, fmt.Sprintf("clock skew: %d records consumed before their send time", result.ClockSkew))
+	}
+	if result.CommitMismatches > 0 {
+		parts = append(parts, fmt.Sprintf("commits: %d partitions with unexpected committed offsets", result.CommitMismatches))
+	}
+	if result.Duplicates > 0 {
+		parts = append(parts, fmt.Sprintf("resume: %d duplicate records", result.Duplicates))
+	}
+	if result.ConfigMismatches > 0 {
+		parts = append(parts, fmt.Sprintf("topics: %d configs not applied by the broker", result.ConfigMismatches))
+	}
+	if durability := result.Durability; durability != nil && durability.Status != "pass" {
+		parts = append(parts, fmt.Sprintf("durability: %d missing, %d corrupted, %d moved of %d records", durability.Missing, durability.Corrupted, durability.Moved, durability.Expected))
+		if durability.Unread > 0 {
+			parts = append(parts, fmt.Sprintf("durability: incomplete read, %d records not reached before the verify timeout", durability.Unread))
+		}
+	}
+	if result.AdminFailures > 0 {
+		parts = append(parts, fmt.Sprintf("admin: %d steps failed their expectations", result.AdminFailures))
+	}
+	if result.GroupFailures > 0 {
+		parts = append(parts, fmt.Sprintf("groups: %d steps failed their expectations", result.GroupFailures))
+	}
+	if result.Cleanup != nil {
+		for _, failure := range result.Cleanup.Failures {
+			parts = append(parts, fmt.Sprintf("cleanup: %s", failure))
+		}
+	}
 	if len(parts) == 0 {
 		return "n.a."
 	}
@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"kaf6/internal/profile"
 )
@@ -34,43 +35,100 @@ type ScenarioFile struct {
 	ProfileDescription string             `json:"-"`
 	ProfileSource      string             `json:"-"`
 	ProfileMetricsURL  string             `json:"-"`
+	Dir                string             `json:"-"`
+	Phase              string             `json:"-"`
+	Manifest           string             `json:"-"`
+	VerifyTimeout      time.Duration      `json:"-"`
 	Brokers            []string           `json:"brokers"`
 	Topics             []TopicSpec        `json:"topics"`
+	Cleanup            string             `json:"cleanup"`
+	Timeout            string             `json:"timeout"`
 	Scenarios          ScenarioCollection `json:"scenarios"`
 	Checks             []CheckSpec        `json:"checks"`
 }
 
 type TopicSpec struct {
-	Name       string `json:"name"`
-	Partitions int32  `json:"partitions"`
-	Recreate   bool   `json:"recreate"`
+	Name              string       `json:"name"`
+	Partitions        int32        `json:"partitions"`
+	ReplicationFactor int16        `json:"replication_factor"`
+	Configs           TopicConfigs `json:"configs"`
+	Recreate          bool         `json:"recreate"`
+}
+
+// TopicConfigs holds topic configs as the strings Kafka expects. Numbers and
+// booleans are accepted as written, so "retention.ms": 3600000 keeps its
+// digits instead of going through a float.
+type TopicConfigs map[string]string
+
+func (c *TopicConfigs) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	out := make(TopicConfigs, len(raw))
+	for key, value := range raw {
+		var text string
+		if err := json.Unmarshal(value, &text); err == nil {
+			out[key] = text
+			continue
+		}
+		if len(value) == 0 || value[0] == '{' || value[0] == '[' || string(value) == "null" {
+			return fmt.Errorf("topic config %s must be a string, number or boolean", key)
+		}
+		out[key] = string(value)
+	}
+	*c = out
+	return nil
 }
 
 type ScenarioCollection struct {
-	Producer *ProducerScenario `json:"producer"`
-	Consumer *ConsumerScenario `json:"consumer"`
-	Metrics  *MetricsScenario  `json:"metrics"`
+	Producer    *ProducerScenario    `json:"producer"`
+	Consumer    *ConsumerScenario    `json:"consumer"`
+	Metrics     *MetricsScenario     `json:"metrics"`
+	Compression *CompressionScenario `json:"compression"`
+	Admin       *AdminScenario       `json:"admin"`
+	Groups      *GroupsScenario      `json:"groups"`
+	Search      *SearchScenario      `json:"search"`
 }
 
 type ProducerScenario struct {
-	Type     string         `json:"type"`
-	Clients  int            `json:"clients"`
-	Messages int            `json:"messages"`
-	RatePerS float64        `json:"rate_per_s"`
-	Topic    string         `json:"topic"`
-	Value    PayloadSpec    `json:"value"`
-	Headers  map[string]any `json:"headers"`
+	Type        string         `json:"type"`
+	Clients     int            `json:"clients"`
+	Messages    int            `json:"messages"`
+	RatePerS    float64        `json:"rate_per_s"`
+	Topic       string         `json:"topic"`
+	Compression string         `json:"compression"`
+	Checksum    string         `json:"checksum"`
+	Mode        string         `json:"mode"`
+	InFlight    int            `json:"in_flight"`
+	Linger      string         `json:"linger"`
+	Value       PayloadSpec    `json:"value"`
+	Headers     map[string]any `json:"headers"`
 }
 
 type ConsumerScenario struct {
 	Type    string         `json:"type"`
 	Clients int            `json:"clients"`
+	Mode    string         `json:"mode"`
 	Topic   string         `json:"topic"`
 	Group   GroupSpec      `json:"group"`
 	Offset  string         `json:"offset"`
+	Commit  string         `json:"commit"`
+	Resume  bool           `json:"resume"`
 	Limit   int            `json:"limit"`
 	Timeout string         `json:"timeout"`
 	Headers map[string]any `json:"headers"`
+	Schema  *SchemaSpec    `json:"schema"`
+
+	// Checksum is the checksum form every record must carry. It defaults
+	// to the producer's checksum mode.
+	Checksum string `json:"checksum"`
+
+	PollTimeout string `json:"poll_timeout"`
+	IdleTimeout string `json:"idle_timeout"`
+	Until       string `json:"until"`
+	Duration    string `json:"duration"`
+	LagInterval string `json:"lag_interval"`
 }
 
 type MetricsScenario struct {
@@ -78,12 +136,115 @@ type MetricsScenario struct {
 	URL  string `json:"url"`
 }
 
+type CompressionScenario struct {
+	Type     string      `json:"type"`
+	Codecs   []string    `json:"codecs"`
+	Messages int         `json:"messages"`
+	Topic    string      `json:"topic"`
+	Timeout  string      `json:"timeout"`
+	Value    PayloadSpec `json:"value"`
+}
+
+type AdminScenario struct {
+	Type  string      `json:"type"`
+	Steps []AdminStep `json:"steps"`
+}
+
+type AdminStep struct {
+	Op                string       `json:"op"`
+	Topic             string       `json:"topic"`
+	Partitions        int32        `json:"partitions"`
+	ReplicationFactor int16        `json:"replication_factor"`
+	Configs           TopicConfigs `json:"configs"`
+	Delete            []string     `json:"delete"`
+	Offset            string       `json:"offset"`
+	Expect            AdminExpect  `json:"expect"`
+}
+
+type AdminExpect struct {
+	Error      string          `json:"error"`
+	Partitions int32           `json:"partitions"`
+	Configs    TopicConfigs    `json:"configs"`
+	Offsets    map[int32]int64 `json:"offsets"`
+	Brokers    int             `json:"brokers"`
+}
+
+type GroupsScenario struct {
+	Type  string      `json:"type"`
+	Steps []GroupStep `json:"steps"`
+}
+
+type GroupStep struct {
+	Op      string          `json:"op"`
+	Group   string          `json:"group"`
+	Topic   string          `json:"topic"`
+	Offset  string          `json:"offset"`
+	Offsets map[int32]int64 `json:"offsets"`
+	Expect  GroupExpect     `json:"expect"`
+}
+
+type GroupExpect struct {
+	Error   string          `json:"error"`
+	Listed  *bool           `json:"listed"`
+	State   string          `json:"state"`
+	Members *int            `json:"members"`
+	Offsets map[int32]int64 `json:"offsets"`
+}
+
+type SearchScenario struct {
+	Type         string            `json:"type"`
+	MinRate      float64           `json:"min_rate"`
+	MaxRate      float64           `json:"max_rate"`
+	Resolution   float64           `json:"resolution"`
+	MaxProbes    int               `json:"max_probes"`
+	StepDuration string            `json:"step_duration"`
+	Cooldown     string            `json:"cooldown"`
+	Producer     *ProducerScenario `json:"producer"`
+	Consumer     *ConsumerScenario `json:"consumer"`
+	SLO          SearchSLO         `json:"slo"`
+}
+
+type SearchSLO struct {
+	ProduceP99Ms     float64 `json:"produce_p99_ms"`
+	EndToEndP99Ms    float64 `json:"end_to_end_p99_ms"`
+	MaxErrors        int64   `json:"max_errors"`
+	MinAchievedRatio float64 `json:"min_achieved_ratio"`
+}
+
 type GroupSpec struct {
-	ID string `json:"id"`
+	ID         string `json:"id"`
+	Balancer   string `json:"balancer"`
+	Protocol   string `json:"protocol"`
+	InstanceID string `json:"instance_id"`
 }
 
 type PayloadSpec struct {
-	JSON map[string]string `json:"json"`
+	Mode     string            `json:"mode"`
+	JSON     map[string]string `json:"json"`
+	Nested   any               `json:"nested"`
+	Template string            `json:"template"`
+	Size     string            `json:"size"`
+	MinSize  string            `json:"min_size"`
+	MaxSize  string            `json:"max_size"`
+	Ratio    float64           `json:"ratio"`
+	Seed     int64             `json:"seed"`
+	Schema   *SchemaSpec       `json:"schema"`
+
+	File               string `json:"file"`
+	Format             string `json:"format"`
+	Order              string `json:"order"`
+	PreserveTiming     bool   `json:"preserve_timing"`
+	OriginalTimestamps bool   `json:"original_timestamps"`
+}
+
+type SchemaSpec struct {
+	Type     string `json:"type"`
+	File     string `json:"file"`
+	Message  string `json:"message"`
+	Source   string `json:"source"`
+	ID       int    `json:"id"`
+	Registry string `json:"registry"`
+	Subject  string `json:"subject"`
 }
 
 type CheckSpec struct {
@@ -102,15 +263,21 @@ func Load(path string) (*ScenarioFile, error) {
 	if err := json.Unmarshal(raw, &spec); err != nil {
 		return nil, err
 	}
+	spec.Dir = filepath.Dir(path)
 	if err := applyProfile(path, &spec); err != nil {
 		return nil, err
 	}
 	if len(spec.Brokers) == 0 {
 		return nil, fmt.Errorf("brokers are required")
 	}
-	if spec.Scenarios.Producer == nil && spec.Scenarios.Consumer == nil && spec.Scenarios.Metrics == nil {
+	if spec.Scenarios.Producer == nil && spec.Scenarios.Consumer == nil && spec.Scenarios.Metrics == nil && spec.Scenarios.Compression == nil && spec.Scenarios.Admin == nil && spec.Scenarios.Groups == nil && spec.Scenarios.Search == nil {
 		return nil, fmt.Errorf("at least one scenario is required")
 	}
+	switch spec.Cleanup {
+	case "", "always", "on_success", "never":
+	default:
+		return nil, fmt.Errorf("unknown cleanup mode: %s", spec.Cleanup)
+	}
 	return &spec, nil
 }
 